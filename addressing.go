@@ -1,44 +1,108 @@
 package ntm
 
 import (
+	"fmt"
 	"log"
 	"math"
+	"sort"
 
 	"github.com/gonum/blas"
 	"github.com/gonum/blas/blas64"
 	"github.com/gonum/floats"
 )
 
-type similarityCircuit struct {
+// A Similarity is a measure of similarity between a head's key vector and a memory vector in content addressing.
+type Similarity int
+
+const (
+	// CosineSimilarity is the cosine of the angle between two vectors, as described in the paper.
+	CosineSimilarity Similarity = iota
+	// DotSimilarity is the dot product of two vectors.
+	DotSimilarity
+	// EuclideanSimilarity is the negative Euclidean distance between two vectors.
+	EuclideanSimilarity
+)
+
+func (s Similarity) String() string {
+	switch s {
+	case CosineSimilarity:
+		return "cosine"
+	case DotSimilarity:
+		return "dot"
+	case EuclideanSimilarity:
+		return "euclidean"
+	}
+	return fmt.Sprintf("Similarity(%d)", int(s))
+}
+
+// value computes the similarity between u and v without building a circuit.
+func (s Similarity) value(u, v []float64) float64 {
+	switch s {
+	case DotSimilarity:
+		return floats.Dot(u, v)
+	case EuclideanSimilarity:
+		return -floats.Distance(u, v, 2)
+	}
+	return cosineSimilarity(u, v)
+}
+
+// similarityUnits holds the two vectors u and v that are compared by a similarityCircuit, as well as their similarity.
+type similarityUnits struct {
 	UVal    []float64
 	UGrad   []float64
 	VVal    []float64
 	VGrad   []float64
 	TopVal  float64
 	TopGrad float64
+}
 
-	UV    float64
-	Unorm float64
-	Vnorm float64
+func (s *similarityUnits) units() *similarityUnits {
+	return s
 }
 
-func newSimilarityCircuit(uVal, uGrad, vVal, vGrad []float64) *similarityCircuit {
-	s := similarityCircuit{
+// A similarityCircuit computes the similarity between two vectors.
+type similarityCircuit interface {
+	units() *similarityUnits
+	// Backward propagates the gradient of the similarity to the two vectors.
+	Backward()
+}
+
+func newSimilarityCircuit(kind Similarity, uVal, uGrad, vVal, vGrad []float64) similarityCircuit {
+	units := similarityUnits{
 		UVal:  uVal,
 		UGrad: uGrad,
 		VVal:  vVal,
 		VGrad: vGrad,
 	}
-	u := blas64.Vector{Inc: 1, Data: uVal}
-	v := blas64.Vector{Inc: 1, Data: vVal}
-	s.UV = blas64.Dot(len(uVal), u, v)
-	s.Unorm = blas64.Nrm2(len(uVal), u)
-	s.Vnorm = blas64.Nrm2(len(vVal), v)
+	switch kind {
+	case DotSimilarity:
+		return newDotCircuit(units)
+	case EuclideanSimilarity:
+		return newEuclideanCircuit(units)
+	}
+	return newCosineCircuit(units)
+}
+
+type cosineCircuit struct {
+	similarityUnits
+
+	UV    float64
+	Unorm float64
+	Vnorm float64
+}
+
+func newCosineCircuit(units similarityUnits) *cosineCircuit {
+	s := cosineCircuit{similarityUnits: units}
+	u := blas64.Vector{Inc: 1, Data: s.UVal}
+	v := blas64.Vector{Inc: 1, Data: s.VVal}
+	s.UV = blas64.Dot(len(s.UVal), u, v)
+	s.Unorm = blas64.Nrm2(len(s.UVal), u)
+	s.Vnorm = blas64.Nrm2(len(s.VVal), v)
 	s.TopVal = s.UV / (s.Unorm * s.Vnorm)
 	return &s
 }
 
-func (s *similarityCircuit) Backward() {
+func (s *cosineCircuit) Backward() {
 	uvuu := s.UV / (s.Unorm * s.Unorm)
 	uvvv := s.UV / (s.Vnorm * s.Vnorm)
 	uvg := s.TopGrad / (s.Unorm * s.Vnorm)
@@ -54,30 +118,82 @@ func (s *similarityCircuit) Backward() {
 	blas64.Axpy(len(s.VGrad), -uvvv*uvg, v, vgrad)
 }
 
+type dotCircuit struct {
+	similarityUnits
+}
+
+func newDotCircuit(units similarityUnits) *dotCircuit {
+	s := dotCircuit{similarityUnits: units}
+	u := blas64.Vector{Inc: 1, Data: s.UVal}
+	v := blas64.Vector{Inc: 1, Data: s.VVal}
+	s.TopVal = blas64.Dot(len(s.UVal), u, v)
+	return &s
+}
+
+func (s *dotCircuit) Backward() {
+	u := blas64.Vector{Inc: 1, Data: s.UVal}
+	v := blas64.Vector{Inc: 1, Data: s.VVal}
+	ugrad := blas64.Vector{Inc: 1, Data: s.UGrad}
+	blas64.Axpy(len(s.UGrad), s.TopGrad, v, ugrad)
+	vgrad := blas64.Vector{Inc: 1, Data: s.VGrad}
+	blas64.Axpy(len(s.VGrad), s.TopGrad, u, vgrad)
+}
+
+type euclideanCircuit struct {
+	similarityUnits
+
+	Dist float64 // the Euclidean distance between u and v
+}
+
+func newEuclideanCircuit(units similarityUnits) *euclideanCircuit {
+	s := euclideanCircuit{similarityUnits: units}
+	var sum float64 = 0
+	for i, u := range s.UVal {
+		d := u - s.VVal[i]
+		sum += d * d
+	}
+	s.Dist = math.Sqrt(sum)
+	s.TopVal = -s.Dist
+	return &s
+}
+
+func (s *euclideanCircuit) Backward() {
+	// The distance is not differentiable when u equals v, in which case we take the subgradient 0.
+	if s.Dist == 0 {
+		return
+	}
+	g := s.TopGrad / s.Dist
+	for i, u := range s.UVal {
+		d := g * (u - s.VVal[i])
+		s.UGrad[i] -= d
+		s.VGrad[i] += d
+	}
+}
+
 type betaSimilarity struct {
 	BetaVal  *float64
 	BetaGrad *float64
 
-	S   *similarityCircuit
+	S   similarityCircuit
 	Top Unit
 
 	b float64
 }
 
-func newBetaSimilarity(betaVal *float64, betaGrad *float64, s *similarityCircuit) *betaSimilarity {
+func newBetaSimilarity(betaVal *float64, betaGrad *float64, s similarityCircuit) *betaSimilarity {
 	bs := betaSimilarity{
 		BetaVal:  betaVal,
 		BetaGrad: betaGrad,
 		S:        s,
 		b:        math.Exp(*betaVal), // Beta is in the range (-Inf, Inf)
 	}
-	bs.Top.Val = bs.b * s.TopVal
+	bs.Top.Val = bs.b * s.units().TopVal
 	return &bs
 }
 
 func (bs *betaSimilarity) Backward() {
-	*bs.BetaGrad += bs.S.TopVal * bs.b * bs.Top.Grad
-	bs.S.TopGrad += bs.b * bs.Top.Grad
+	*bs.BetaGrad += bs.S.units().TopVal * bs.b * bs.Top.Grad
+	bs.S.units().TopGrad += bs.b * bs.Top.Grad
 }
 
 type contentAddressing struct {
@@ -164,6 +280,12 @@ type shiftedWeighting struct {
 	SVal  *float64
 	SGrad *float64
 
+	// ShiftVal and ShiftGrad are the unnormalized shift distribution of a convolutional shift,
+	// and are nil when the shift is a scalar.
+	ShiftVal  []float64
+	ShiftGrad []float64
+	shift     []float64 // the normalized shift distribution
+
 	Z   float64
 	WG  *gatedWeighting
 	Top []Unit
@@ -199,7 +321,71 @@ func newShiftedWeighting(sVal *float64, sGrad *float64, wg *gatedWeighting) *shi
 	return &sw
 }
 
+// newConvShiftedWeighting returns a shiftedWeighting which circularly convolves the gated weighting with
+// a softmax distribution over the shifts -len(shiftVal)/2, ..., (len(shiftVal)-1)/2.
+func newConvShiftedWeighting(shiftVal, shiftGrad []float64, wg *gatedWeighting) *shiftedWeighting {
+	sw := shiftedWeighting{
+		ShiftVal:  shiftVal,
+		ShiftGrad: shiftGrad,
+		shift:     make([]float64, len(shiftVal)),
+		WG:        wg,
+		Top:       make([]Unit, len(wg.Top)),
+	}
+
+	var max float64 = -math.MaxFloat64
+	for _, v := range shiftVal {
+		max = math.Max(max, v)
+	}
+	var sum float64 = 0
+	for i, v := range shiftVal {
+		sw.shift[i] = math.Exp(v - max)
+		sum += sw.shift[i]
+	}
+	for i := range sw.shift {
+		sw.shift[i] = sw.shift[i] / sum
+	}
+
+	n := len(sw.Top)
+	for i := range sw.Top {
+		for j, s := range sw.shift {
+			sw.Top[i].Val += sw.WG.Top[sw.shiftedIndex(i, j, n)].Val * s
+		}
+	}
+	return &sw
+}
+
+// shiftedIndex returns the index of the gated weighting that is shifted to i by the j-th shift.
+func (sw *shiftedWeighting) shiftedIndex(i, j, n int) int {
+	offset := j - len(sw.shift)/2
+	return ((i-offset)%n + n) % n
+}
+
+func (sw *shiftedWeighting) backwardConv() {
+	n := len(sw.Top)
+	grads := make([]float64, len(sw.shift))
+	for i, top := range sw.Top {
+		for j, s := range sw.shift {
+			k := sw.shiftedIndex(i, j, n)
+			grads[j] += top.Grad * sw.WG.Top[k].Val
+			sw.WG.Top[k].Grad += top.Grad * s
+		}
+	}
+
+	var gs float64 = 0
+	for j, s := range sw.shift {
+		gs += grads[j] * s
+	}
+	for j, s := range sw.shift {
+		sw.ShiftGrad[j] += (grads[j] - gs) * s
+	}
+}
+
 func (sw *shiftedWeighting) Backward() {
+	if sw.ShiftVal != nil {
+		sw.backwardConv()
+		return
+	}
+
 	var grad float64 = 0
 	n := len(sw.WG.Top)
 	for i := 0; i < len(sw.Top); i++ {
@@ -296,22 +482,24 @@ func (rf *refocus) Backward() {
 type memRead struct {
 	W      *refocus
 	Memory *writtenMemory
+	Offset int // the position in memory vectors where the read part starts, which is non-zero in key value memories
 
 	TopVal  []float64
 	TopGrad []float64
 }
 
-func newMemRead(w *refocus, memory *writtenMemory) *memRead {
+func newMemRead(w *refocus, memory *writtenMemory, offset int) *memRead {
 	m := len(memory.TopVal) / memory.N
 	r := memRead{
 		W:       w,
 		Memory:  memory,
-		TopVal:  make([]float64, m),
-		TopGrad: make([]float64, m),
+		Offset:  offset,
+		TopVal:  make([]float64, m-offset),
+		TopGrad: make([]float64, m-offset),
 	}
 
 	weights := blas64.Vector{Inc: 1, Data: w.TopVal}
-	mem := blas64.General{Rows: memory.N, Cols: m, Stride: m, Data: memory.TopVal}
+	mem := blas64.General{Rows: memory.N, Cols: m - offset, Stride: m, Data: memory.TopVal[offset:]}
 	top := blas64.Vector{Inc: 1, Data: r.TopVal}
 	blas64.Gemv(blas.Trans, 1, mem, weights, 1, top)
 
@@ -323,11 +511,11 @@ func (r *memRead) Backward() {
 	m := len(r.Memory.TopVal) / n
 
 	grad := blas64.Vector{Inc: 1, Data: r.TopGrad}
-	memVal := blas64.General{Rows: n, Cols: m, Stride: m, Data: r.Memory.TopVal}
+	memVal := blas64.General{Rows: n, Cols: m - r.Offset, Stride: m, Data: r.Memory.TopVal[r.Offset:]}
 	weightsGrad := blas64.Vector{Inc: 1, Data: r.W.TopGrad}
 	blas64.Gemv(blas.NoTrans, 1, memVal, grad, 1, weightsGrad)
 
-	memGrad := blas64.General{Rows: n, Cols: m, Stride: m, Data: r.Memory.TopGrad}
+	memGrad := blas64.General{Rows: n, Cols: m - r.Offset, Stride: m, Data: r.Memory.TopGrad[r.Offset:]}
 	weights := blas64.Vector{Inc: 1, Data: r.W.TopVal}
 	blas64.Ger(1, weights, grad, memGrad)
 }
@@ -495,42 +683,228 @@ func (wm *writtenMemory) Backward() {
 	wm.backwardMtm1()
 }
 
+// newMemContentAddressing creates the content addressing circuit of a head on a memory bank.
+func newMemContentAddressing(h *Head, memory *writtenMemory) *contentAddressing {
+	m := len(memory.TopVal) / memory.N
+	ss := make([]*betaSimilarity, memory.N)
+	for i := range ss {
+		s := newSimilarityCircuit(h.Similarity, h.KVal(), h.KGrad(), memory.TopVal[i*m:i*m+h.keyLen()], memory.TopGrad[i*m:i*m+h.keyLen()])
+		ss[i] = newBetaSimilarity(h.BetaVal(), h.BetaGrad(), s)
+	}
+	return newContentAddressing(ss)
+}
+
+// backwardMemContentAddressing performs a backward pass on a circuit created by newMemContentAddressing.
+func backwardMemContentAddressing(ca *contentAddressing) {
+	ca.Backward()
+	for _, bs := range ca.Units {
+		bs.Backward()
+		bs.S.Backward()
+	}
+}
+
+// lruaWeighting is the write weighting of a head in least recently used access.
+type lruaWeighting struct {
+	AlphaVal  *float64
+	AlphaGrad *float64
+
+	Wtm1  *refocus  // the weights at time t-1
+	LUtm1 []float64 // the least used locations at time t-1
+	Top   *refocus
+
+	alpha float64
+}
+
+func newLRUAWeighting(alphaVal *float64, alphaGrad *float64, wtm1 *refocus, lutm1 []float64) *lruaWeighting {
+	lw := lruaWeighting{
+		AlphaVal:  alphaVal,
+		AlphaGrad: alphaGrad,
+		Wtm1:      wtm1,
+		LUtm1:     lutm1,
+		Top: &refocus{
+			TopVal:  make([]float64, len(lutm1)),
+			TopGrad: make([]float64, len(lutm1)),
+		},
+		alpha: Sigmoid(*alphaVal),
+	}
+	for i := range lw.Top.TopVal {
+		lw.Top.TopVal[i] = lw.alpha*wtm1.TopVal[i] + (1-lw.alpha)*lutm1[i]
+	}
+	return &lw
+}
+
+func (lw *lruaWeighting) Backward() {
+	var grad float64 = 0
+	for i, g := range lw.Top.TopGrad {
+		grad += g * (lw.Wtm1.TopVal[i] - lw.LUtm1[i])
+		lw.Wtm1.TopGrad[i] += g * lw.alpha
+	}
+	*lw.AlphaGrad += grad * lw.alpha * (1 - lw.alpha)
+}
+
+// leastUsed returns an indicator of the n least used locations, where ties are broken by position.
+// All locations are indicated if n exceeds their number, such as when there are more heads than locations.
+func leastUsed(usage []float64, n int) []float64 {
+	if n > len(usage) {
+		n = len(usage)
+	}
+	order := make([]int, len(usage))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return usage[order[a]] < usage[order[b]]
+	})
+	lu := make([]float64, len(usage))
+	for _, i := range order[:n] {
+		lu[i] = 1
+	}
+	return lu
+}
+
 type memOp struct {
 	W  []*refocus
 	R  []*memRead
 	WM *writtenMemory
+
+	// LW are the write weightings of heads in least recently used access, which is enabled if Usage is non nil.
+	LW        []*lruaWeighting
+	Usage     []float64
+	LeastUsed []float64
+	Decay     float64
 }
 
 func newMemOp(heads []*Head, mtm1 *writtenMemory) *memOp {
 	circuit := memOp{
-		R: make([]*memRead, len(heads)),
+		R: make([]*memRead, 0, len(heads)),
 	}
 	circuit.W = make([]*refocus, len(heads))
+	writers := make([]*Head, 0, len(heads))
+	ws := make([]*refocus, 0, len(heads))
 	for wi, h := range heads {
-		ss := make([]*betaSimilarity, mtm1.N)
-		for i := 0; i < mtm1.N; i++ {
-			m := len(mtm1.TopVal) / mtm1.N
-			s := newSimilarityCircuit(h.KVal(), h.KGrad(), mtm1.TopVal[i*m:(i+1)*m], mtm1.TopGrad[i*m:(i+1)*m])
-			ss[i] = newBetaSimilarity(h.BetaVal(), h.BetaGrad(), s)
-		}
-		wc := newContentAddressing(ss)
+		wc := newMemContentAddressing(h, mtm1)
 		wg := newGatedWeighting(h.GVal(), h.GGrad(), wc, h.Wtm1)
-		ws := newShiftedWeighting(h.SVal(), h.SGrad(), wg)
-		circuit.W[wi] = newRefocus(h.GammaVal(), h.GammaGrad(), ws)
-		circuit.R[wi] = newMemRead(circuit.W[wi], mtm1)
-	}
+		var sw *shiftedWeighting
+		if h.ShiftWidth > 0 {
+			sw = newConvShiftedWeighting(h.ShiftVal(), h.ShiftGrad(), wg)
+		} else {
+			sw = newShiftedWeighting(h.SVal(), h.SGrad(), wg)
+		}
+		circuit.W[wi] = newRefocus(h.GammaVal(), h.GammaGrad(), sw)
+		if h.reads() {
+			circuit.R = append(circuit.R, newMemRead(circuit.W[wi], mtm1, h.KeySize))
+		}
 
-	circuit.WM = newWrittenMemory(circuit.W, heads, mtm1)
+		if !h.writes() {
+			continue
+		}
+		w := circuit.W[wi]
+		if h.kind == lruaHead {
+			lw := newLRUAWeighting(h.AlphaVal(), h.AlphaGrad(), h.Wtm1, h.LUtm1)
+			circuit.LW = append(circuit.LW, lw)
+			w = lw.Top
+		}
+		writers = append(writers, h)
+		ws = append(ws, w)
+	}
+	circuit.WM = newWrittenMemory(ws, writers, mtm1)
 	return &circuit
 }
 
+// updateUsage decays the usage at time t-1, and adds the read and write weights at time t to it.
+func (c *memOp) updateUsage(prev *memOp) {
+	c.Decay = prev.Decay
+	c.Usage = make([]float64, len(prev.Usage))
+	for i, u := range prev.Usage {
+		c.Usage[i] = c.Decay * u
+		for _, r := range c.R {
+			c.Usage[i] += r.W.TopVal[i]
+		}
+		for _, w := range c.WM.Ws {
+			c.Usage[i] += w.TopVal[i]
+		}
+	}
+	c.LeastUsed = leastUsed(c.Usage, len(c.W))
+}
+
+func (c *memOp) reads() []*memRead {
+	return c.R
+}
+
+func (c *memOp) weights() []*refocus {
+	return c.W
+}
+
+func (c *memOp) next(heads []*Head) memoryOp {
+	for i, h := range heads {
+		h.Wtm1 = c.W[i]
+		h.LUtm1 = c.LeastUsed
+	}
+	op := newMemOp(heads, c.WM)
+	if c.Usage != nil {
+		op.updateUsage(c)
+	}
+	return op
+}
+
+func (c *memOp) truncate() memoryOp {
+	op := memOp{
+		W:         make([]*refocus, len(c.W)),
+		R:         make([]*memRead, len(c.R)),
+		WM:        detachMemory(c.WM),
+		Usage:     c.Usage,
+		LeastUsed: c.LeastUsed,
+		Decay:     c.Decay,
+	}
+	for i, w := range c.W {
+		op.W[i] = detachWeights(w)
+	}
+	for i, r := range c.R {
+		op.R[i] = detachRead(r)
+	}
+	return &op
+}
+
+func (c *memOp) checkpoint() memoryOp {
+	return c.truncate()
+}
+
+func (c *memOp) setGrads(ck memoryOp) {
+	o := ck.(*memOp)
+	for i, w := range o.W {
+		copy(c.W[i].TopGrad, w.TopGrad)
+	}
+	for i, r := range o.R {
+		copy(c.R[i].TopGrad, r.TopGrad)
+	}
+	copy(c.WM.TopGrad, o.WM.TopGrad)
+}
+
+// detachWeights returns weights with the same values as w, but without the circuit that computes them.
+func detachWeights(w *refocus) *refocus {
+	return &refocus{TopVal: w.TopVal, TopGrad: make([]float64, len(w.TopVal))}
+}
+
+// detachRead returns a read with the same values as r, but without the memory and weights it is computed from.
+func detachRead(r *memRead) *memRead {
+	return &memRead{Offset: r.Offset, TopVal: r.TopVal, TopGrad: make([]float64, len(r.TopVal))}
+}
+
+// detachMemory returns a memory with the same values as m, but without the memory at time t-1 and the writes.
+func detachMemory(m *writtenMemory) *writtenMemory {
+	return &writtenMemory{N: m.N, TopVal: m.TopVal, TopGrad: make([]float64, len(m.TopVal))}
+}
+
 func (c *memOp) Backward() {
 	for _, r := range c.R {
 		r.Backward()
 	}
 	c.WM.Backward()
+	for _, lw := range c.LW {
+		lw.Backward()
+	}
 
-	for _, rf := range c.WM.Ws {
+	for _, rf := range c.W {
 		rf.Backward()
 		rf.SW.Backward()
 		rf.SW.WG.Backward()
@@ -17,8 +17,44 @@ const (
 )
 
 func TestCircuit(t *testing.T) {
-	n := 3
-	m := 2
+	testCircuit(t, MemorySpec{N: 3, M: 2, NumHeads: 2})
+}
+
+func TestCircuitConvShift(t *testing.T) {
+	testCircuit(t, MemorySpec{N: 3, M: 2, NumHeads: 2, ShiftWidth: 3})
+}
+
+func TestCircuitDotSimilarity(t *testing.T) {
+	testCircuit(t, MemorySpec{N: 3, M: 2, NumHeads: 2, Similarity: DotSimilarity})
+}
+
+func TestCircuitEuclideanSimilarity(t *testing.T) {
+	testCircuit(t, MemorySpec{N: 3, M: 2, NumHeads: 2, Similarity: EuclideanSimilarity})
+}
+
+func TestCircuitLRUA(t *testing.T) {
+	testCircuit(t, MemorySpec{N: 4, M: 2, NumHeads: 2, LRUA: true})
+}
+
+func TestCircuitLRUAMoreHeadsThanLocations(t *testing.T) {
+	testCircuit(t, MemorySpec{N: 2, M: 2, NumHeads: 3, LRUA: true})
+}
+
+func TestCircuitReadWriteHeads(t *testing.T) {
+	testCircuit(t, MemorySpec{N: 3, M: 2, NumHeads: 1, NumReadHeads: 2, NumWriteHeads: 1})
+}
+
+func TestCircuitLRUAReadWriteHeads(t *testing.T) {
+	testCircuit(t, MemorySpec{N: 4, M: 2, NumReadHeads: 1, NumWriteHeads: 2, LRUA: true})
+}
+
+func TestCircuitKeyValue(t *testing.T) {
+	testCircuit(t, MemorySpec{N: 3, M: 5, NumHeads: 1, NumReadHeads: 1, NumWriteHeads: 1, KeySize: 2})
+}
+
+func testCircuit(t *testing.T, mem MemorySpec) {
+	n := mem.N
+	m := mem.M
 	memory := &writtenMemory{
 		N:       n,
 		TopVal:  make([]float64, n*m),
@@ -29,13 +65,21 @@ func TestCircuit(t *testing.T) {
 			memory.TopVal[i*m+j] = rand.Float64()
 		}
 	}
-	hul := headUnitsLen(m)
-	heads := make([]*Head, 2)
+	var lu []float64
+	if mem.LRUA {
+		usage := make([]float64, n)
+		for i := range usage {
+			usage[i] = rand.Float64()
+		}
+		lu = leastUsed(usage, mem.numWeightings())
+	}
+	heads := mem.emptyHeads()
 	for i := 0; i < len(heads); i++ {
-		heads[i] = NewHead(m)
+		hul := heads[i].unitsLen()
 		heads[i].vals = make([]float64, hul)
 		heads[i].grads = make([]float64, hul)
 		heads[i].Wtm1 = randomRefocus(n)
+		heads[i].LUtm1 = lu
 		for j := 0; j < hul; j++ {
 			heads[i].vals[j] = rand.Float64()
 		}
@@ -75,12 +119,19 @@ func TestCircuit(t *testing.T) {
 	}
 	ax := addressing(heads, memoryTop)
 	checkGamma(t, heads, memoryTop, ax)
-	checkS(t, heads, memoryTop, ax)
+	if mem.ShiftWidth > 0 {
+		checkShift(t, heads, memoryTop, ax)
+	} else {
+		checkS(t, heads, memoryTop, ax)
+	}
 	checkG(t, heads, memoryTop, ax)
 	checkWtm1(t, heads, memoryTop, ax)
 	checkBeta(t, heads, memoryTop, ax)
 	checkK(t, heads, memoryTop, ax)
 	checkMemory(t, heads, memoryTop, ax)
+	if mem.LRUA {
+		checkAlpha(t, heads, memoryTop, ax)
+	}
 }
 
 func addressing(heads []*Head, memory [][]Unit) float64 {
@@ -93,9 +144,15 @@ func doAddressing(heads []*Head, memory [][]Unit) (weights [][]float64, reads []
 		// Content-based addressing
 		beta := math.Exp(*h.BetaVal())
 		wc := make([]float64, len(memory))
+		var max float64 = -math.MaxFloat64
+		for j := 0; j < len(wc); j++ {
+			wc[j] = beta * similarity(h.Similarity, h.KVal(), unitVals(memory[j])[:h.keyLen()])
+			max = math.Max(max, wc[j])
+		}
+		// Subtract the maximum as the circuits do, since exp overflows when beta is large.
 		var sum float64 = 0
 		for j := 0; j < len(wc); j++ {
-			wc[j] = math.Exp(beta * cosineSimilarity(h.KVal(), unitVals(memory[j])))
+			wc[j] = math.Exp(wc[j] - max)
 			sum += wc[j]
 		}
 		for j := 0; j < len(wc); j++ {
@@ -110,15 +167,30 @@ func doAddressing(heads []*Head, memory [][]Unit) (weights [][]float64, reads []
 
 		// Location-based addressing
 		n := len(weights[i])
-		//s := math.Mod(h.S().Val, float64(n))
-		//if s < 0 {
-		//	s += float64(n)
-		//}
-		s := math.Mod((2*Sigmoid(*h.SVal())-1)+float64(n), float64(n))
-		for j := 0; j < n; j++ {
-			imj := (j + int(s)) % n
-			simj := 1 - (s - math.Floor(s))
-			weights[i][j] = wc[imj]*simj + wc[(imj+1)%n]*(1-simj)
+		if h.ShiftWidth > 0 {
+			shift := make([]float64, h.ShiftWidth)
+			sum = 0
+			for k, v := range h.ShiftVal() {
+				shift[k] = math.Exp(v)
+				sum += shift[k]
+			}
+			for j := 0; j < n; j++ {
+				for k := range shift {
+					offset := k - h.ShiftWidth/2
+					weights[i][j] += wc[((j-offset)%n+n)%n] * shift[k] / sum
+				}
+			}
+		} else {
+			//s := math.Mod(h.S().Val, float64(n))
+			//if s < 0 {
+			//	s += float64(n)
+			//}
+			s := math.Mod((2*Sigmoid(*h.SVal())-1)+float64(n), float64(n))
+			for j := 0; j < n; j++ {
+				imj := (j + int(s)) % n
+				simj := 1 - (s - math.Floor(s))
+				weights[i][j] = wc[imj]*simj + wc[(imj+1)%n]*(1-simj)
+			}
 		}
 
 		// Refocusing
@@ -133,12 +205,30 @@ func doAddressing(heads []*Head, memory [][]Unit) (weights [][]float64, reads []
 		}
 	}
 
-	reads = makeTensor2(len(heads), len(memory[0]))
 	for i, w := range weights {
-		r := reads[i]
+		if !heads[i].reads() {
+			continue
+		}
+		r := make([]float64, len(memory[0])-heads[i].KeySize)
 		for j := 0; j < len(r); j++ {
 			for k := 0; k < len(w); k++ {
-				r[j] += w[k] * memory[k][j].Val
+				r[j] += w[k] * memory[k][heads[i].KeySize+j].Val
+			}
+		}
+		reads = append(reads, r)
+	}
+
+	// Least recently used access writes to the locations read at time t-1 or the least used locations.
+	writeWeights := weights
+	if heads[0].kind == lruaHead {
+		writeWeights = makeTensor2(len(heads), len(memory))
+		for i, h := range heads {
+			if !h.writes() {
+				continue
+			}
+			alpha := Sigmoid(*h.AlphaVal())
+			for j := range writeWeights[i] {
+				writeWeights[i][j] = alpha*h.Wtm1.TopVal[j] + (1-alpha)*h.LUtm1[j]
 			}
 		}
 	}
@@ -146,6 +236,9 @@ func doAddressing(heads []*Head, memory [][]Unit) (weights [][]float64, reads []
 	erase := makeTensor2(len(heads), len(memory[0]))
 	add := makeTensor2(len(heads), len(memory[0]))
 	for k := 0; k < len(heads); k++ {
+		if !heads[k].writes() {
+			continue
+		}
 		eraseVec := heads[k].EraseVal()
 		for i := 0; i < len(erase[k]); i++ {
 			erase[k][i] = Sigmoid(eraseVec[i])
@@ -160,16 +253,38 @@ func doAddressing(heads []*Head, memory [][]Unit) (weights [][]float64, reads []
 		for j := 0; j < len(newMem[i]); j++ {
 			newMem[i][j] = memory[i][j].Val
 			for k := 0; k < len(heads); k++ {
-				newMem[i][j] = newMem[i][j] * (1 - weights[k][i]*erase[k][j])
+				if heads[k].writes() {
+					newMem[i][j] = newMem[i][j] * (1 - writeWeights[k][i]*erase[k][j])
+				}
 			}
 			for k := 0; k < len(heads); k++ {
-				newMem[i][j] += weights[k][i] * add[k][j]
+				if heads[k].writes() {
+					newMem[i][j] += writeWeights[k][i] * add[k][j]
+				}
 			}
 		}
 	}
 	return weights, reads, newMem
 }
 
+func similarity(kind Similarity, u, v []float64) float64 {
+	switch kind {
+	case DotSimilarity:
+		var sum float64 = 0
+		for i := range u {
+			sum += u[i] * v[i]
+		}
+		return sum
+	case EuclideanSimilarity:
+		var sum float64 = 0
+		for i := range u {
+			sum += (u[i] - v[i]) * (u[i] - v[i])
+		}
+		return -math.Sqrt(sum)
+	}
+	return cosineSimilarity(u, v)
+}
+
 func addressingLoss(weights [][]float64, reads [][]float64, newMem [][]float64) float64 {
 	var res float64 = 0
 	for i, w := range weights {
@@ -314,6 +429,27 @@ func checkS(t *testing.T, heads []*Head, memory [][]Unit, ax float64) {
 	}
 }
 
+func checkShift(t *testing.T, heads []*Head, memory [][]Unit, ax float64) {
+	for k, hd := range heads {
+		for i := range hd.ShiftVal() {
+			x := hd.ShiftVal()[i]
+			h := machineEpsilonSqrt * math.Max(math.Abs(x), 1)
+			xph := x + h
+			hd.ShiftVal()[i] = xph
+			dx := xph - x
+			axph := addressing(heads, memory)
+			grad := (axph - ax) / dx
+			hd.ShiftVal()[i] = x
+
+			if math.IsNaN(grad) || math.Abs(grad-hd.ShiftGrad()[i]) > 1e-5 {
+				t.Fatalf("wrong shift[%d] gradient expected %f, got %f", i, grad, hd.ShiftGrad()[i])
+			} else {
+				t.Logf("OK shift[%d][%d] agradient %f %f", k, i, grad, hd.ShiftGrad()[i])
+			}
+		}
+	}
+}
+
 func checkGamma(t *testing.T, heads []*Head, memory [][]Unit, ax float64) {
 	for k, hd := range heads {
 		x := *hd.GammaVal()
@@ -333,6 +469,28 @@ func checkGamma(t *testing.T, heads []*Head, memory [][]Unit, ax float64) {
 	}
 }
 
+func checkAlpha(t *testing.T, heads []*Head, memory [][]Unit, ax float64) {
+	for k, hd := range heads {
+		if !hd.writes() {
+			continue
+		}
+		x := *hd.AlphaVal()
+		h := machineEpsilonSqrt * math.Max(math.Abs(x), 1)
+		xph := x + h
+		*hd.AlphaVal() = xph
+		dx := xph - x
+		axph := addressing(heads, memory)
+		grad := (axph - ax) / dx
+		*hd.AlphaVal() = x
+
+		if math.IsNaN(grad) || math.Abs(grad-(*hd.AlphaGrad())) > 1e-5 {
+			t.Fatalf("wrong alpha gradient expected %f, got %f", grad, *hd.AlphaGrad())
+		} else {
+			t.Logf("OK alpha[%d] gradient %f %f", k, grad, *hd.AlphaGrad())
+		}
+	}
+}
+
 func randomRefocus(n int) *refocus {
 	w := make([]float64, n)
 	var sum float64 = 0
@@ -0,0 +1,67 @@
+package associativerecall
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// GenSeq generates a sequence of the associative recall task in the paper, in which the NTM is presented a list of
+// numItems items, each of which consists of itemLen random binary vectors of size vectorSize.
+// After the items, one of them except the last is presented again as the query, and the NTM is expected to output
+// the item that follows the query in the list.
+//
+// The input has two additional delimiter channels. The channel vectorSize is set on the time step before each item,
+// and the channel vectorSize+1 is set on the time steps before and after the query.
+// The output is 0 except for the last itemLen time steps, in which the item following the query is expected.
+//
+// GenSeq panics if numItems is less than 2, since the query must be followed by another item.
+func GenSeq(numItems, itemLen, vectorSize int) ([][]float64, [][]float64) {
+	if numItems < 2 {
+		panic(fmt.Sprintf("associative recall needs at least 2 items, got %d", numItems))
+	}
+	items := make([][][]float64, numItems)
+	for i := range items {
+		items[i] = make([][]float64, itemLen)
+		for j := range items[i] {
+			items[i][j] = make([]float64, vectorSize)
+			for k := range items[i][j] {
+				items[i][j][k] = float64(rand.Intn(2))
+			}
+		}
+	}
+	query := rand.Intn(numItems - 1)
+
+	input := make([][]float64, 0)
+	appendMarker := func(channel int) {
+		v := make([]float64, vectorSize+2)
+		v[channel] = 1
+		input = append(input, v)
+	}
+	appendItem := func(item [][]float64) {
+		for _, datum := range item {
+			v := make([]float64, vectorSize+2)
+			copy(v, datum)
+			input = append(input, v)
+		}
+	}
+	for _, item := range items {
+		appendMarker(vectorSize)
+		appendItem(item)
+	}
+	appendMarker(vectorSize + 1)
+	appendItem(items[query])
+	appendMarker(vectorSize + 1)
+
+	output := make([][]float64, len(input))
+	for i := range output {
+		output[i] = make([]float64, vectorSize)
+	}
+	for _, datum := range items[query+1] {
+		input = append(input, make([]float64, vectorSize+2))
+		v := make([]float64, vectorSize)
+		copy(v, datum)
+		output = append(output, v)
+	}
+
+	return input, output
+}
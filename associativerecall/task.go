@@ -0,0 +1,58 @@
+package associativerecall
+
+import (
+	"fmt"
+	"math/rand"
+
+	"ntm"
+	"ntm/task"
+)
+
+func init() {
+	task.Register("associativerecall", func(string) (task.Task, error) {
+		return &Task{MinItems: 2, MaxItems: 6, ItemLen: 3, VectorSize: 6}, nil
+	})
+}
+
+// Task is the associative recall task as a task.Task, in which NTMs are trained on lists of MinItems to MaxItems
+// items, each of which consists of ItemLen vectors of VectorSize bits. MinItems must be at least 2, as in GenSeq.
+type Task struct {
+	MinItems   int
+	MaxItems   int
+	ItemLen    int
+	VectorSize int
+}
+
+func (t *Task) InputSize() int {
+	return t.VectorSize + 2
+}
+
+func (t *Task) OutputSize() int {
+	return t.VectorSize
+}
+
+func (t *Task) Sample() task.Seq {
+	return t.seq(rand.Intn(t.MaxItems-t.MinItems+1) + t.MinItems)
+}
+
+func (t *Task) seq(numItems int) task.Seq {
+	x, y := GenSeq(numItems, t.ItemLen, t.VectorSize)
+	return task.Seq{X: x, Y: y, Model: &ntm.LogisticModel{Y: y}}
+}
+
+// Loss returns the loss in nats per bit of the recalled item.
+func (t *Task) Loss(seq task.Seq, predictions [][]float64) float64 {
+	return seq.Model.Loss(predictions) / float64(t.ItemLen*t.VectorSize)
+}
+
+func (t *Task) Evals() []task.Eval {
+	numItems := []int{2, 6, 10, 15, 20}
+	evals := make([]task.Eval, 0, len(numItems))
+	for _, n := range numItems {
+		evals = append(evals, task.Eval{
+			Name:   fmt.Sprintf("%d items", n),
+			Sample: func() task.Seq { return t.seq(n) },
+		})
+	}
+	return evals
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"ntm"
+	"ntm/associativerecall"
+	"ntm/tester"
+)
+
+var weightsFile = flag.String("weightsFile", "", "a checkpoint or trained weights in JSON")
+
+func main() {
+	flag.Parse()
+	if *weightsFile == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	t := &associativerecall.Task{MinItems: 2, MaxItems: 6, ItemLen: 3, VectorSize: 6}
+	spec := ntm.ControllerSpec{Type: ntm.Controller1Type, XSize: t.InputSize(), YSize: t.OutputSize(), HSize: 100, Memories: []ntm.MemorySpec{{N: 128, M: 20, NumHeads: 1}}}
+	ck, err := ntm.LoadCheckpoint(*weightsFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if ck.Task != "" && ck.Task != "associativerecall" {
+		log.Fatalf("%s is a checkpoint of task %q, not %q", *weightsFile, ck.Task, "associativerecall")
+	}
+	// Bare arrays of weights are of the controller trained by associativerecall/train.
+	c, err := ck.NewControllerWithDefault(spec)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if err := tester.Serve(":9000", tester.Evaluate(t, c)); err != nil {
+		log.Printf("%v", err)
+	}
+}
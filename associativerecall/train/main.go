@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+
+	"ntm"
+	"ntm/associativerecall"
+	"ntm/trainer"
+)
+
+func main() {
+	flag.Parse()
+
+	// The items in the paper consist of 3 vectors of 6 bits, and there are between 2 and 6 items in training.
+	t := &associativerecall.Task{MinItems: 2, MaxItems: 6, ItemLen: 3, VectorSize: 6}
+	trainer.Run(t, trainer.Config{
+		Task: "associativerecall",
+		Spec: ntm.ControllerSpec{
+			Type:     ntm.Controller1Type,
+			XSize:    t.InputSize(),
+			YSize:    t.OutputSize(),
+			HSize:    100,
+			Memories: []ntm.MemorySpec{{N: 128, M: 20, NumHeads: 1}},
+		},
+		Seed: 2,
+		Port: 8089,
+	})
+}
@@ -0,0 +1,188 @@
+package ntm
+
+import (
+	"fmt"
+)
+
+// memories are the memory banks of a controller.
+// The heads of the first bank come first in the output of a controller, followed by those of the second bank and so on.
+// The same holds for the reads, the initial weights and memories in the biases of a controller.
+type memories []MemorySpec
+
+// A multiMemoryController is a Controller that describes its memory banks, which may be several, each with its own
+// options such as DNC or LRUA.
+type multiMemoryController interface {
+	// Memories returns the descriptions of the memory banks of a controller, each with its own heads.
+	// The heads returned by Heads are the heads of the first bank, followed by those of the second bank and so on.
+	Memories() []MemorySpec
+}
+
+// controllerMemories returns the memory banks of c. A controller that does not implement Memories, such as one
+// implemented outside this package, has a single bank of NumHeads heads and MemoryN vectors of size MemoryM.
+func controllerMemories(c Controller) memories {
+	if mc, ok := c.(multiMemoryController); ok {
+		return mc.Memories()
+	}
+	return memories{{N: c.MemoryN(), M: c.MemoryM(), NumHeads: c.NumHeads()}}
+}
+
+// numReadUnits returns the total size of the vectors read from all banks in a time step.
+func (ms memories) numReadUnits() int {
+	n := 0
+	for _, m := range ms {
+		n += m.numReads() * m.readSize()
+	}
+	return n
+}
+
+// numHeadUnits returns the number of units emitted by the controller for the heads of all banks.
+func (ms memories) numHeadUnits() int {
+	n := 0
+	for _, m := range ms {
+		n += m.numHeadUnits()
+	}
+	return n
+}
+
+// numWeightings returns the number of heads whose initial weights are in the bias of a controller.
+func (ms memories) numWeightings() int {
+	n := 0
+	for _, m := range ms {
+		n += m.numWeightings()
+	}
+	return n
+}
+
+// numWtm1Units returns the size of the bias of the initial weights.
+func (ms memories) numWtm1Units() int {
+	n := 0
+	for _, m := range ms {
+		n += m.numWeightings() * m.N
+	}
+	return n
+}
+
+// numMtm1Units returns the size of the bias of the initial memories.
+func (ms memories) numMtm1Units() int {
+	n := 0
+	for _, m := range ms {
+		n += m.N * m.M
+	}
+	return n
+}
+
+// newHeads creates the heads of all banks whose units are stored in vals and grads.
+func (ms memories) newHeads(vals, grads []float64) []*Head {
+	heads := make([]*Head, 0, ms.numWeightings()+len(ms))
+	for _, m := range ms {
+		n := m.numHeadUnits()
+		if grads == nil {
+			heads = append(heads, m.newHeads(vals[:n], nil)...)
+		} else {
+			heads = append(heads, m.newHeads(vals[:n], grads[:n])...)
+			grads = grads[n:]
+		}
+		vals = vals[n:]
+	}
+	return heads
+}
+
+// wtm1Desc describes the i-th weight in the bias of the initial weights.
+func (ms memories) wtm1Desc(i int) string {
+	for b, m := range ms {
+		size := m.numWeightings() * m.N
+		if i >= size {
+			i -= size
+			continue
+		}
+		if len(ms) == 1 {
+			return fmt.Sprintf("wtm1[%d][%d]", i/m.N, i%m.N)
+		}
+		return fmt.Sprintf("wtm1[%d][%d][%d]", b, i/m.N, i%m.N)
+	}
+	return fmt.Sprintf("wtm1[%d]", i)
+}
+
+// mtm1Desc describes the i-th weight in the bias of the initial memories.
+func (ms memories) mtm1Desc(i int) string {
+	for b, m := range ms {
+		size := m.N * m.M
+		if i >= size {
+			i -= size
+			continue
+		}
+		if len(ms) == 1 {
+			return fmt.Sprintf("mtm1[%d][%d]", i/m.M, i%m.M)
+		}
+		return fmt.Sprintf("mtm1[%d][%d][%d]", b, i/m.M, i%m.M)
+	}
+	return fmt.Sprintf("mtm1[%d]", i)
+}
+
+// banksOp operates on several independent memory banks, each of which is operated on by its own heads.
+type banksOp struct {
+	Banks []memoryOp
+
+	numHeads []int // the number of heads of each bank
+	r        []*memRead
+}
+
+func newBanksOp(banks []memoryOp, numHeads []int) *banksOp {
+	op := banksOp{
+		Banks:    banks,
+		numHeads: numHeads,
+	}
+	for _, b := range banks {
+		op.r = append(op.r, b.reads()...)
+	}
+	return &op
+}
+
+func (op *banksOp) reads() []*memRead {
+	return op.r
+}
+
+func (op *banksOp) weights() []*refocus {
+	ws := make([]*refocus, 0)
+	for _, b := range op.Banks {
+		ws = append(ws, b.weights()...)
+	}
+	return ws
+}
+
+func (op *banksOp) next(heads []*Head) memoryOp {
+	banks := make([]memoryOp, len(op.Banks))
+	for i, b := range op.Banks {
+		banks[i] = b.next(heads[:op.numHeads[i]])
+		heads = heads[op.numHeads[i]:]
+	}
+	return newBanksOp(banks, op.numHeads)
+}
+
+func (op *banksOp) truncate() memoryOp {
+	banks := make([]memoryOp, len(op.Banks))
+	for i, b := range op.Banks {
+		banks[i] = b.truncate()
+	}
+	return newBanksOp(banks, op.numHeads)
+}
+
+func (op *banksOp) checkpoint() memoryOp {
+	banks := make([]memoryOp, len(op.Banks))
+	for i, b := range op.Banks {
+		banks[i] = b.checkpoint()
+	}
+	return newBanksOp(banks, op.numHeads)
+}
+
+func (op *banksOp) setGrads(ck memoryOp) {
+	for i, b := range ck.(*banksOp).Banks {
+		op.Banks[i].setGrads(b)
+	}
+}
+
+func (op *banksOp) Backward() {
+	for _, b := range op.Banks {
+		b.Backward()
+	}
+}
@@ -0,0 +1,51 @@
+package ntm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMemoryBanks(t *testing.T) {
+	times := 7
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	y := makeTensor2(times, 4)
+	for i := 0; i < len(y); i++ {
+		for j := 0; j < len(y[i]); j++ {
+			y[i][j] = rand.Float64()
+		}
+	}
+	h1Size := 3
+	mems := []MemorySpec{
+		{N: 3, M: 2, NumHeads: 1},
+		{N: 5, M: 3, NumHeads: 1, DNC: true, KeySize: 2},
+		{N: 7, M: 4, NumReadHeads: 2, NumWriteHeads: 1, SparseK: 2, KeySize: 2},
+	}
+	c := NewEmptyController1WithMemory(len(x[0]), len(y[0]), h1Size, mems...)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &LogisticModel{Y: y}
+	machines := ForwardBackward(c, x, model)
+	bhws := BankHeadWeights(machines)
+	if len(bhws) != len(mems) {
+		t.Fatalf("got weights of %d banks, expected %d", len(bhws), len(mems))
+	}
+	for b, mem := range mems {
+		if len(bhws[b]) != len(mem.emptyHeads()) {
+			t.Errorf("got weights of %d heads in bank %d, expected %d", len(bhws[b]), b, len(mem.emptyHeads()))
+		}
+		for i := range bhws[b] {
+			if len(bhws[b][i]) != times || len(bhws[b][i][0]) != mem.N {
+				t.Errorf("wrong shape of weights of head %d in bank %d", i, b)
+			}
+		}
+	}
+	checkForwardBackwardGradients(t, c, x, model)
+}
@@ -0,0 +1,83 @@
+package ntm
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ForwardBackwardBatch performs ForwardBackward on a minibatch of sequences, in which in[i] is the input of the
+// i-th sequence and out[i] its density model. It returns the machines of each sequence.
+//
+// The sequences are processed concurrently by at most runtime.GOMAXPROCS(0) goroutines, each of which
+// backpropagates into its own gradient buffers by way of WithWeightsGrad. Afterwards, the gradients of c are set to
+// the sum of the gradients of all sequences.
+// Controllers without a WithWeightsGrad method, such as those implemented outside this package, process the sequences
+// one after another instead.
+func ForwardBackwardBatch(c Controller, in [][][]float64, out []DensityModel) [][]*NTM {
+	grad := c.WeightsGrad()
+	for i := range grad {
+		grad[i] = 0
+	}
+	machines := make([][]*NTM, len(in))
+	ws, ok := c.(weightsGradSharer)
+	if !ok {
+		sum := make([]float64, len(grad))
+		for i := range in {
+			machines[i] = ForwardBackward(c, in[i], out[i])
+			for j, g := range grad {
+				sum[j] += g
+			}
+		}
+		copy(grad, sum)
+		return machines
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(in) {
+		workers = len(in)
+	}
+
+	seqs := make(chan int)
+	sums := make([][]float64, workers)
+	var wg sync.WaitGroup
+	for w := range sums {
+		sums[w] = make([]float64, len(grad))
+		wg.Add(1)
+		go func(sum []float64) {
+			defer wg.Done()
+			wc := ws.WithWeightsGrad(make([]float64, len(grad)))
+			for i := range seqs {
+				machines[i] = ForwardBackward(wc, in[i], out[i])
+				for j, g := range wc.WeightsGrad() {
+					sum[j] += g
+				}
+			}
+		}(sums[w])
+	}
+	for i := range in {
+		seqs <- i
+	}
+	close(seqs)
+	wg.Wait()
+
+	for _, sum := range sums {
+		for j, g := range sum {
+			grad[j] += g
+		}
+	}
+	return machines
+}
+
+// A weightsGradSharer is a Controller whose weights can be shared by Controllers with their own gradient buffers.
+type weightsGradSharer interface {
+	// WithWeightsGrad returns a Controller which shares the weights of this Controller, but accumulates its
+	// gradients in grad instead, so that several sequences can be backpropagated concurrently.
+	WithWeightsGrad(grad []float64) Controller
+}
+
+// TrainBatch computes the gradients of a minibatch with ForwardBackwardBatch, and updates the weights of c with opt,
+// which must be an Optimizer of c.
+func TrainBatch(opt Optimizer, c Controller, in [][][]float64, out []DensityModel) [][]*NTM {
+	machines := ForwardBackwardBatch(c, in, out)
+	opt.Update()
+	return machines
+}
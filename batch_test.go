@@ -0,0 +1,62 @@
+package ntm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestForwardBackwardBatch(t *testing.T) {
+	controllers := map[string]Controller{
+		"controller1": NewEmptyController1(3, 2, 4, 2, 5, 3),
+		"lstm":        NewEmptyLSTMControllerWithMemory(3, 2, 4, MemorySpec{N: 5, M: 3, NumHeads: 1, DNC: true}),
+		"sparse":      NewEmptyController1WithMemory(3, 2, 4, MemorySpec{N: 9, M: 3, NumHeads: 2, SparseK: 3}),
+		// The method set of a struct embedding a Controller lacks WithWeightsGrad and Memories.
+		"sequential": struct{ Controller }{NewEmptyController1(3, 2, 4, 2, 5, 3)},
+	}
+	for name, c := range controllers {
+		weights := c.WeightsVal()
+		for i := range weights {
+			weights[i] = 2*rand.Float64() - 1
+		}
+		batchSize := 5
+		in := make([][][]float64, batchSize)
+		out := make([]DensityModel, batchSize)
+		for b := range in {
+			times := rand.Intn(6) + 1
+			in[b] = makeTensor2(times, 3)
+			y := makeTensor2(times, 2)
+			for i := range in[b] {
+				for j := range in[b][i] {
+					in[b][i][j] = rand.Float64()
+				}
+				for j := range y[i] {
+					y[i][j] = rand.Float64()
+				}
+			}
+			out[b] = &LogisticModel{Y: y}
+		}
+
+		expected := make([]float64, len(weights))
+		expectedLoss := make([]float64, batchSize)
+		for b := range in {
+			machines := ForwardBackward(c, in[b], out[b])
+			expectedLoss[b] = out[b].Loss(Predictions(machines))
+			for i, g := range c.WeightsGrad() {
+				expected[i] += g
+			}
+		}
+
+		machines := ForwardBackwardBatch(c, in, out)
+		for b := range in {
+			if l := out[b].Loss(Predictions(machines[b])); math.Abs(l-expectedLoss[b]) > 1e-12 {
+				t.Errorf("%s: loss of sequence %d is %f, expected %f", name, b, l, expectedLoss[b])
+			}
+		}
+		for i, g := range c.WeightsGrad() {
+			if math.Abs(g-expected[i]) > 1e-9 {
+				t.Errorf("%s: wrong %s gradient %f, expected %f", name, c.WeightsDesc(i), g, expected[i])
+			}
+		}
+	}
+}
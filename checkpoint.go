@@ -0,0 +1,275 @@
+package ntm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// The types of controllers in a ControllerSpec.
+const (
+	Controller1Type = "controller1"
+	FeedforwardType = "feedforward"
+	GRUType         = "gru"
+	LSTMType        = "lstm"
+)
+
+// A ControllerSpec describes the architecture of a controller, from which an empty controller can be created.
+type ControllerSpec struct {
+	// Type is the type of the controller, which is one of Controller1Type, FeedforwardType, GRUType and LSTMType.
+	Type  string
+	XSize int
+	YSize int
+	// HSize is the size of the hidden layer of controller1, and the size of the hidden state of GRU and LSTM controllers.
+	HSize int `json:",omitempty"`
+	// Layers are the hidden layers of a feedforward controller.
+	Layers   []Layer `json:",omitempty"`
+	Memories []MemorySpec
+}
+
+// NewEmpty creates an empty controller whose architecture is described by s.
+func (s ControllerSpec) NewEmpty() (Controller, error) {
+	if len(s.Memories) == 0 {
+		return nil, fmt.Errorf("no memory banks in %s controller", s.Type)
+	}
+	switch s.Type {
+	case Controller1Type:
+		return NewEmptyController1WithMemory(s.XSize, s.YSize, s.HSize, s.Memories...), nil
+	case FeedforwardType:
+		return NewEmptyFeedforwardControllerWithMemory(s.XSize, s.YSize, s.Layers, s.Memories...), nil
+	case GRUType:
+		return NewEmptyGRUControllerWithMemory(s.XSize, s.YSize, s.HSize, s.Memories...), nil
+	case LSTMType:
+		return NewEmptyLSTMControllerWithMemory(s.XSize, s.YSize, s.HSize, s.Memories...), nil
+	}
+	return nil, fmt.Errorf("unknown controller type %q", s.Type)
+}
+
+// An OptimizerState is the type, hyperparameters and accumulated state of an Optimizer,
+// from which the Optimizer can be recreated.
+type OptimizerState struct {
+	// Type is the name of the Optimizer type, such as "RMSProp" or "Adam".
+	Type string
+	// Clipping is the gradient clipping of a ClippedOptimizer, which wraps the Optimizer described by Type and State.
+	Clipping *GradientClipping `json:",omitempty"`
+	// State is the JSON encoding of the Optimizer, such as the Params, N, G and D of RMSProp.
+	State json.RawMessage
+}
+
+func newOptimizerState(opt Optimizer) (*OptimizerState, error) {
+	s := OptimizerState{}
+	if co, ok := opt.(*ClippedOptimizer); ok {
+		clipping := co.Clipping
+		s.Clipping = &clipping
+		opt = co.Optimizer
+	}
+	switch opt.(type) {
+	case *SGDMomentum:
+		s.Type = "SGDMomentum"
+	case *RMSProp:
+		s.Type = "RMSProp"
+	case *Adam:
+		s.Type = "Adam"
+	case *AdamW:
+		s.Type = "AdamW"
+	case *Adagrad:
+		s.Type = "Adagrad"
+	case *Adadelta:
+		s.Type = "Adadelta"
+	default:
+		return nil, fmt.Errorf("unsupported optimizer %T", opt)
+	}
+	b, err := json.Marshal(opt)
+	if err != nil {
+		return nil, err
+	}
+	s.State = b
+	return &s, nil
+}
+
+// NewOptimizer recreates the Optimizer described by s, which trains the controller c.
+func (s *OptimizerState) NewOptimizer(c Controller) (Optimizer, error) {
+	var opt Optimizer
+	switch s.Type {
+	case "SGDMomentum":
+		opt = NewSGDMomentumWithParams(c, SGDMomentumParams{})
+	case "RMSProp":
+		opt = NewRMSPropWithParams(c, RMSPropParams{})
+	case "Adam":
+		opt = NewAdam(c, AdamParams{})
+	case "AdamW":
+		opt = NewAdamW(c, AdamWParams{})
+	case "Adagrad":
+		opt = NewAdagrad(c, AdagradParams{})
+	case "Adadelta":
+		opt = NewAdadelta(c, AdadeltaParams{})
+	default:
+		return nil, fmt.Errorf("unknown optimizer type %q", s.Type)
+	}
+	if err := json.Unmarshal(s.State, opt); err != nil {
+		return nil, fmt.Errorf("%s state: %v", s.Type, err)
+	}
+	if s.Clipping != nil {
+		opt = NewClippedOptimizer(c, opt, *s.Clipping)
+	}
+	return opt, nil
+}
+
+// A Checkpoint is a snapshot of a training run, which describes the architecture of the trained controller along
+// with its weights, so that the controller can be recreated without knowing its shape beforehand.
+//
+// A Checkpoint also holds the full state of a training run, from which training can be resumed.
+// Since the position of the random number generator cannot be saved, training programs restore it by seeding with
+// Seed and replaying the random draws of the first Iteration iterations, after which the training run continues as
+// if it had never stopped.
+type Checkpoint struct {
+	Controller ControllerSpec
+	Weights    []float64
+
+	// Optimizer is the state of the Optimizer, which is nil if the Optimizer is unknown.
+	Optimizer *OptimizerState `json:",omitempty"`
+	Iteration int             // the number of training iterations so far
+	Seed      int64           // the seed provided to rand.Seed at the start of the training run
+	Losses    []float64       // the history of losses reported by the training run
+	// Task is the name of the task on which the controller is trained, see package ntm/task.
+	Task string `json:",omitempty"`
+	// TaskData is the dataset of the task, for tasks that need one.
+	TaskData string `json:",omitempty"`
+}
+
+// A specifier is a Controller that can describe its architecture, so that it can be checkpointed.
+type specifier interface {
+	// spec returns the description of the architecture of this Controller.
+	spec() ControllerSpec
+}
+
+// NewCheckpoint creates a Checkpoint of the controller c trained by opt after the given number of iterations,
+// in a training run seeded by seed. opt may be nil, in which case the Checkpoint records no optimizer state.
+// The weights and the optimizer state are copied, so that further training does not affect the Checkpoint.
+// c must be one of the controllers of this package, whose architectures can be described by a ControllerSpec.
+func NewCheckpoint(c Controller, opt Optimizer, iteration int, seed int64) (*Checkpoint, error) {
+	sc, ok := c.(specifier)
+	if !ok {
+		return nil, fmt.Errorf("unsupported controller %T", c)
+	}
+	ck := Checkpoint{
+		Controller: sc.spec(),
+		Weights:    append([]float64(nil), c.WeightsVal()...),
+		Iteration:  iteration,
+		Seed:       seed,
+	}
+	if opt != nil {
+		s, err := newOptimizerState(opt)
+		if err != nil {
+			return nil, err
+		}
+		ck.Optimizer = s
+	}
+	return &ck, nil
+}
+
+// NewController creates the controller described by the Checkpoint, and sets its weights to those in the Checkpoint.
+func (ck *Checkpoint) NewController() (Controller, error) {
+	if ck.Controller.Type == "" {
+		return nil, fmt.Errorf("checkpoint does not describe its controller")
+	}
+	c, err := ck.Controller.NewEmpty()
+	if err != nil {
+		return nil, err
+	}
+	if len(ck.Weights) != len(c.WeightsVal()) {
+		return nil, fmt.Errorf("checkpoint has %d weights, but its %s controller has %d", len(ck.Weights), ck.Controller.Type, len(c.WeightsVal()))
+	}
+	copy(c.WeightsVal(), ck.Weights)
+	return c, nil
+}
+
+// NewControllerWithDefault is like NewController, except that a Checkpoint which does not describe its controller,
+// such as a bare array of weights read by ReadCheckpoint, is taken to be a checkpoint of the controller described
+// by spec.
+func (ck *Checkpoint) NewControllerWithDefault(spec ControllerSpec) (Controller, error) {
+	if ck.Controller.Type == "" {
+		withSpec := *ck
+		withSpec.Controller = spec
+		return withSpec.NewController()
+	}
+	return ck.NewController()
+}
+
+// NewOptimizer recreates the Optimizer in the Checkpoint, which trains the controller c.
+func (ck *Checkpoint) NewOptimizer(c Controller) (Optimizer, error) {
+	if ck.Optimizer == nil {
+		return nil, fmt.Errorf("checkpoint has no optimizer state")
+	}
+	return ck.Optimizer.NewOptimizer(c)
+}
+
+// Resume recreates the controller and the Optimizer in the Checkpoint, so that training can be resumed.
+func (ck *Checkpoint) Resume() (Controller, Optimizer, error) {
+	c, err := ck.NewController()
+	if err != nil {
+		return nil, nil, err
+	}
+	opt, err := ck.NewOptimizer(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, opt, nil
+}
+
+// Write writes the Checkpoint in JSON to w.
+func (ck *Checkpoint) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(ck)
+}
+
+// ReadCheckpoint reads a Checkpoint in JSON from r.
+// For backward compatibility, r may also contain a bare JSON array of weights, as dumped by the training programs
+// before checkpoints existed, in which case the returned Checkpoint has only its Weights set.
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ck := Checkpoint{}
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		err = json.Unmarshal(b, &ck.Weights)
+	} else {
+		err = json.Unmarshal(b, &ck)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ck, nil
+}
+
+// Save writes the Checkpoint to the named file. The Checkpoint is first written to a temporary file which is then
+// renamed, so that an interrupted Save does not leave a truncated checkpoint behind.
+func (ck *Checkpoint) Save(filename string) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := ck.Write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// LoadCheckpoint reads a Checkpoint from the named file, see ReadCheckpoint.
+func LoadCheckpoint(filename string) (*Checkpoint, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCheckpoint(f)
+}
@@ -0,0 +1,185 @@
+package ntm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointController(t *testing.T) {
+	for name, c := range inferenceControllers() {
+		weights := c.WeightsVal()
+		for i := range weights {
+			weights[i] = 2*rand.Float64() - 1
+		}
+		ck, err := NewCheckpoint(c, nil, 3, 7)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var buf bytes.Buffer
+		if err := ck.Write(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ck, err = ReadCheckpoint(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if ck.Iteration != 3 || ck.Seed != 7 || ck.Optimizer != nil {
+			t.Errorf("%s: iteration %d, seed %d, optimizer %v", name, ck.Iteration, ck.Seed, ck.Optimizer)
+		}
+
+		lc, err := ck.NewController()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		x := makeTensor2(5, 3)
+		for i := range x {
+			for j := range x[i] {
+				x[i][j] = rand.Float64()
+			}
+		}
+		expected := NewInference(c, &MultinomialModel{})
+		inf := NewInference(lc, &MultinomialModel{})
+		for i := range x {
+			checkRunnerOutput(t, name, i, inf.Step(x[i]), expected.Step(x[i]))
+		}
+	}
+}
+
+func TestCheckpointOptimizer(t *testing.T) {
+	newOptimizers := map[string]func(c Controller) Optimizer{
+		"sgd":     func(c Controller) Optimizer { return NewSGDMomentum(c) },
+		"rmsprop": func(c Controller) Optimizer { return NewRMSProp(c) },
+		"adamw": func(c Controller) Optimizer {
+			return NewAdamW(c, AdamWParams{AdamParams: AdamParams{LearningRate: 1e-3, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}, WeightDecay: 1e-2})
+		},
+		"adagrad": func(c Controller) Optimizer { return NewAdagrad(c, AdagradParams{LearningRate: 1e-2, Epsilon: 1e-8}) },
+		"clipped adadelta": func(c Controller) Optimizer {
+			return NewClippedOptimizer(c, NewAdadelta(c, AdadeltaParams{Rho: 0.95, Epsilon: 1e-6}), GradientClipping{Norm: 1})
+		},
+	}
+	for name, newOpt := range newOptimizers {
+		c := NewEmptyController1(3, 3, 4, 1, 5, 3)
+		weights := c.WeightsVal()
+		for i := range weights {
+			weights[i] = 2*rand.Float64() - 1
+		}
+		x := makeTensor2(6, 3)
+		y := make([]int, len(x))
+		for i := range x {
+			for j := range x[i] {
+				x[i][j] = rand.Float64()
+			}
+			y[i] = rand.Intn(3)
+		}
+		opt := newOpt(c)
+		opt.Train(x, &MultinomialModel{Y: y})
+
+		var buf bytes.Buffer
+		ck, err := NewCheckpoint(c, opt, 1, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ck.Losses = []float64{0.5}
+		if err := ck.Write(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		ck, err = ReadCheckpoint(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		lc, lopt, err := ck.Resume()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(ck.Losses) != 1 || ck.Losses[0] != 0.5 {
+			t.Errorf("%s: losses %v", name, ck.Losses)
+		}
+
+		// The restored optimizer should continue training exactly as the original one.
+		for k := 0; k < 3; k++ {
+			opt.Train(x, &MultinomialModel{Y: y})
+			lopt.Train(x, &MultinomialModel{Y: y})
+		}
+		for i, w := range c.WeightsVal() {
+			if lw := lc.WeightsVal()[i]; lw != w {
+				t.Errorf("%s: weight[%d] %g, expected %g", name, i, lw, w)
+			}
+		}
+	}
+}
+
+func TestReadCheckpointWeights(t *testing.T) {
+	ck, err := ReadCheckpoint(strings.NewReader("[0.5, -1, 2]\n"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(ck.Weights) != 3 || ck.Weights[1] != -1 {
+		t.Errorf("weights %v", ck.Weights)
+	}
+	if _, err := ck.NewController(); err == nil {
+		t.Errorf("expected an error for a checkpoint without its controller")
+	}
+
+	ck.Controller = ControllerSpec{Type: Controller1Type, XSize: 3, YSize: 3, HSize: 4, Memories: []MemorySpec{{N: 5, M: 3, NumHeads: 1}}}
+	if _, err := ck.NewController(); err == nil {
+		t.Errorf("expected an error for a mismatched number of weights")
+	}
+}
+
+func TestCheckpointControllerWithDefault(t *testing.T) {
+	spec := ControllerSpec{Type: Controller1Type, XSize: 3, YSize: 3, HSize: 4, Memories: []MemorySpec{{N: 5, M: 3, NumHeads: 1}}}
+	c, err := spec.NewEmpty()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i := range c.WeightsVal() {
+		c.WeightsVal()[i] = rand.Float64()
+	}
+	b, err := json.Marshal(c.WeightsVal())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ck, err := ReadCheckpoint(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	bare, err := ck.NewControllerWithDefault(spec)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ck.Controller.Type != "" {
+		t.Errorf("the checkpoint is modified to describe %+v", ck.Controller)
+	}
+
+	ck, err = NewCheckpoint(c, nil, 0, 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// The controller of a checkpoint that describes it takes precedence over spec.
+	other := ControllerSpec{Type: GRUType, XSize: 3, YSize: 3, HSize: 4, Memories: []MemorySpec{{N: 5, M: 3, NumHeads: 1}}}
+	described, err := ck.NewControllerWithDefault(other)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, lc := range []Controller{bare, described} {
+		if len(lc.WeightsVal()) != len(c.WeightsVal()) {
+			t.Fatalf("%d weights, expected %d", len(lc.WeightsVal()), len(c.WeightsVal()))
+		}
+		for i, w := range c.WeightsVal() {
+			if lw := lc.WeightsVal()[i]; lw != w {
+				t.Errorf("weight[%d] %g, expected %g", i, lw, w)
+			}
+		}
+	}
+}
+
+func TestCheckpointUnsupportedController(t *testing.T) {
+	// The method set of a struct embedding a Controller has only the exported methods of Controller.
+	c := struct{ Controller }{NewEmptyController1(3, 3, 4, 1, 5, 3)}
+	if _, err := NewCheckpoint(c, nil, 0, 1); err == nil {
+		t.Errorf("expected an error for a controller that does not describe its architecture")
+	}
+}
@@ -0,0 +1,71 @@
+package ntm
+
+import (
+	"math"
+)
+
+// GradientClipping specifies how the gradients of a controller are clipped before they update its weights.
+// Graves, Alex (2013). Generating sequences with recurrent neural networks. arXiv preprint arXiv:1308.0850.
+type GradientClipping struct {
+	// Value clips each gradient to the range [-Value, Value] if positive.
+	Value float64
+	// Norm rescales the gradients so that their global L2 norm is at most Norm if positive.
+	// It is applied after the element-wise clipping by Value.
+	Norm float64
+}
+
+// Clip clips the gradients of the weights of c in place, and returns the L2 norm of the gradients before clipping.
+func (gc GradientClipping) Clip(c Controller) float64 {
+	grads := c.WeightsGrad()
+	norm := gradNorm(grads)
+	if gc.Value > 0 {
+		for i, g := range grads {
+			grads[i] = math.Max(-gc.Value, math.Min(gc.Value, g))
+		}
+	}
+	if gc.Norm > 0 {
+		if n := gradNorm(grads); n > gc.Norm {
+			s := gc.Norm / n
+			for i := range grads {
+				grads[i] *= s
+			}
+		}
+	}
+	return norm
+}
+
+func gradNorm(grads []float64) float64 {
+	var sum float64 = 0
+	for _, g := range grads {
+		sum += g * g
+	}
+	return math.Sqrt(sum)
+}
+
+// ClippedOptimizer is an Optimizer that clips the gradients between ForwardBackward and the update of the
+// Optimizer it wraps.
+type ClippedOptimizer struct {
+	Optimizer
+	C        Controller
+	Clipping GradientClipping
+
+	// Norm is the L2 norm of the gradients before clipping in the latest update, which is useful for monitoring
+	// exploding gradients.
+	Norm float64
+}
+
+// NewClippedOptimizer wraps opt, which trains the controller c, with gradient clipping.
+func NewClippedOptimizer(c Controller, opt Optimizer, clipping GradientClipping) *ClippedOptimizer {
+	return &ClippedOptimizer{Optimizer: opt, C: c, Clipping: clipping}
+}
+
+func (o *ClippedOptimizer) Train(x [][]float64, y DensityModel) []*NTM {
+	machines := ForwardBackward(o.C, x, y)
+	o.Update()
+	return machines
+}
+
+func (o *ClippedOptimizer) Update() {
+	o.Norm = o.Clipping.Clip(o.C)
+	o.Optimizer.Update()
+}
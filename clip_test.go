@@ -0,0 +1,62 @@
+package ntm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGradientClipping(t *testing.T) {
+	c := NewEmptyController1(1, 1, 1, 1, 1, 1)
+	setGrads := func() {
+		for i := range c.WeightsGrad() {
+			c.WeightsGrad()[i] = 0
+		}
+		c.WeightsGrad()[0] = 3
+		c.WeightsGrad()[1] = -4
+		c.WeightsGrad()[2] = 0.5
+	}
+	norm := math.Sqrt(3*3 + 4*4 + 0.5*0.5)
+
+	setGrads()
+	if n := (GradientClipping{Value: 1}).Clip(c); math.Abs(n-norm) > 1e-12 {
+		t.Errorf("norm %f, expected %f", n, norm)
+	}
+	checkGrads(t, c, []float64{1, -1, 0.5})
+
+	setGrads()
+	GradientClipping{Norm: norm / 2}.Clip(c)
+	checkGrads(t, c, []float64{1.5, -2, 0.25})
+
+	setGrads()
+	GradientClipping{Norm: 2 * norm}.Clip(c)
+	checkGrads(t, c, []float64{3, -4, 0.5})
+
+	setGrads()
+	GradientClipping{Value: 1, Norm: 1.5}.Clip(c)
+	checkGrads(t, c, []float64{1, -1, 0.5})
+}
+
+func TestClippedOptimizer(t *testing.T) {
+	c := NewEmptyController1(1, 1, 1, 1, 1, 1)
+	sgd := NewSGDMomentumWithParams(c, SGDMomentumParams{LearningRate: 0.1})
+	opt := NewClippedOptimizer(c, sgd, GradientClipping{Value: 1})
+	c.WeightsVal()[0] = 1.1
+	c.WeightsGrad()[0] = 2.7
+	c.WeightsVal()[1] = 1.2
+	c.WeightsGrad()[1] = -0.3
+
+	opt.Update()
+	if math.Abs(opt.Norm-math.Sqrt(2.7*2.7+0.3*0.3)) > 1e-12 {
+		t.Errorf("norm %f, expected %f", opt.Norm, math.Sqrt(2.7*2.7+0.3*0.3))
+	}
+	checkOptimizer(t, "w", 0, c.WeightsVal()[0], 1)
+	checkOptimizer(t, "w", 1, c.WeightsVal()[1], 1.23)
+}
+
+func checkGrads(t *testing.T, c Controller, expected []float64) {
+	for i, e := range expected {
+		if g := c.WeightsGrad()[i]; math.Abs(g-e) > 1e-12 {
+			t.Errorf("grad[%d](%g) != %g", i, g, e)
+		}
+	}
+}
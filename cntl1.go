@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas32"
 	"github.com/gonum/blas/blas64"
 )
 
@@ -22,20 +23,18 @@ type controller1 struct {
 	outVal  []float64
 	outGrad []float64
 
-	numHeads int
-	memoryM  int
-	memoryN  int
-	xSize    int
-	h1Size   int
-	ySize    int
+	mems   memories
+	xSize  int
+	h1Size int
+	ySize  int
 }
 
 func (c *controller1) wh1Cols() int {
-	return c.numHeads*c.memoryM + c.xSize + 1
+	return c.mems.numReadUnits() + c.xSize + 1
 }
 
 func (c *controller1) wyRows() int {
-	return c.ySize + c.numHeads*headUnitsLen(c.memoryM)
+	return c.ySize + c.mems.numHeadUnits()
 }
 
 func (c *controller1) wyOffset() int {
@@ -47,11 +46,11 @@ func (c *controller1) wtm1Offset() int {
 }
 
 func (c *controller1) mtm1Offset() int {
-	return c.wtm1Offset() + c.numHeads*c.memoryN
+	return c.wtm1Offset() + c.mems.numWtm1Units()
 }
 
 func (c *controller1) numWeights() int {
-	return c.mtm1Offset() + c.memoryN*c.memoryM
+	return c.mtm1Offset() + c.mems.numMtm1Units()
 }
 
 func (c *controller1) wh1(w []float64) blas64.General {
@@ -109,13 +108,17 @@ func (c *controller1) Mtm1BiasGrad() []float64 {
 // NewEmptyController1 returns a new controller1 which is a single layer feedforward network.
 // The returned controller1 is empty in that all its network weights are initialized as 0.
 func NewEmptyController1(xSize, ySize, h1Size, numHeads, n, m int) *controller1 {
+	return NewEmptyController1WithMemory(xSize, ySize, h1Size, MemorySpec{N: n, M: m, NumHeads: numHeads})
+}
+
+// NewEmptyController1WithMemory is like NewEmptyController1, except that the memory banks and their heads are described by mems.
+// The heads of the first bank come first, followed by those of the second bank and so on.
+func NewEmptyController1WithMemory(xSize, ySize, h1Size int, mems ...MemorySpec) *controller1 {
 	c := controller1{
-		numHeads: numHeads,
-		memoryM:  m,
-		memoryN:  n,
-		xSize:    xSize,
-		h1Size:   h1Size,
-		ySize:    ySize,
+		mems:   mems,
+		xSize:  xSize,
+		h1Size: h1Size,
+		ySize:  ySize,
 	}
 	c.weightsVal = make([]float64, c.numWeights())
 	c.weightsGrad = make([]float64, c.numWeights())
@@ -142,24 +145,23 @@ func (old *controller1) Forward(reads []*memRead, x []float64) Controller {
 		X:           x,
 		H1Val:       make([]float64, old.h1Size+1),
 		H1Grad:      make([]float64, old.h1Size+1),
-		heads:       make([]*Head, len(reads)),
 		outVal:      make([]float64, old.wyRows()),
 		outGrad:     make([]float64, old.wyRows()),
 
-		numHeads: old.numHeads,
-		memoryM:  old.memoryM,
-		memoryN:  old.memoryN,
-		xSize:    old.xSize,
-		h1Size:   old.h1Size,
-		ySize:    old.ySize,
+		mems:   old.mems,
+		xSize:  old.xSize,
+		h1Size: old.h1Size,
+		ySize:  old.ySize,
 	}
 
 	ud := make([]float64, c.wh1Cols())
-	for i, read := range reads {
-		copy(ud[i*c.memoryM:], read.TopVal)
+	pos := 0
+	for _, read := range reads {
+		copy(ud[pos:], read.TopVal)
+		pos += len(read.TopVal)
 	}
-	copy(ud[c.numHeads*c.memoryM:], c.X)
-	ud[c.numHeads*c.memoryM+c.xSize] = 1
+	copy(ud[c.mems.numReadUnits():], c.X)
+	ud[c.mems.numReadUnits()+c.xSize] = 1
 	c.ReadsXVal = blas64.Vector{Inc: 1, Data: ud}
 
 	h1 := blas64.Vector{Inc: 1, Data: c.H1Val[0:c.h1Size]}
@@ -173,14 +175,7 @@ func (old *controller1) Forward(reads []*memRead, x []float64) Controller {
 	outV := blas64.Vector{Inc: 1, Data: c.outVal}
 	blas64.Gemv(blas.NoTrans, 1, c.wyVal(), h1, 1, outV)
 
-	hul := headUnitsLen(c.memoryM)
-	for i := range c.heads {
-		head := NewHead(c.memoryM)
-		c.heads[i] = head
-		start := c.ySize + i*hul
-		head.vals = c.outVal[start : start+hul]
-		head.grads = c.outGrad[start : start+hul]
-	}
+	c.heads = c.mems.newHeads(c.outVal[c.ySize:], c.outGrad[c.ySize:])
 
 	return &c
 }
@@ -202,8 +197,10 @@ func (c *controller1) Backward() {
 	blas64.Gemv(blas.Trans, 1, c.wh1Val(), h1Grad, 1, u)
 	blas64.Ger(1, h1Grad, c.ReadsXVal, c.wh1Grad())
 
-	for i, read := range c.Reads {
-		copy(read.TopGrad, u.Data[i*c.memoryM:(i+1)*c.memoryM])
+	pos := 0
+	for _, read := range c.Reads {
+		copy(read.TopGrad, u.Data[pos:pos+len(read.TopGrad)])
+		pos += len(read.TopGrad)
 	}
 }
 
@@ -215,6 +212,117 @@ func (c *controller1) WeightsGrad() []float64 {
 	return c.weightsGrad
 }
 
+func (c *controller1) WithWeightsGrad(grad []float64) Controller {
+	cc := *c
+	cc.weightsGrad = grad
+	return &cc
+}
+
+func (c *controller1) truncate() Controller {
+	cc := *c
+	cc.Reads = nil
+	cc.heads = nil
+	return &cc
+}
+
+// setGrads does nothing, since the controller carries no states across time steps.
+func (c *controller1) setGrads(ck Controller) {}
+
+// controller1Inference runs a controller1 forward with buffers that are reused across time steps.
+type controller1Inference struct {
+	c *controller1
+	// wh1 and wy are the weights of c, which are computed once since computing their layout allocates.
+	wh1 blas64.General
+	wy  blas64.General
+
+	readsX []float64
+	h1     []float64
+	out    []float64
+}
+
+func (c *controller1) inference() controllerInference {
+	ci := controller1Inference{
+		c:      c,
+		wh1:    c.wh1Val(),
+		wy:     c.wyVal(),
+		readsX: make([]float64, c.wh1Cols()),
+		h1:     make([]float64, c.h1Size+1),
+		out:    make([]float64, c.wyRows()),
+	}
+	return &ci
+}
+
+func (ci *controller1Inference) forward(reads, x []float64) {
+	c := ci.c
+	copy(ci.readsX, reads)
+	copy(ci.readsX[len(reads):], x)
+	ci.readsX[len(ci.readsX)-1] = 1
+
+	h1 := blas64.Vector{Inc: 1, Data: ci.h1[0:c.h1Size]}
+	blas64.Gemv(blas.NoTrans, 1, ci.wh1, blas64.Vector{Inc: 1, Data: ci.readsX}, 0, h1)
+	for i, h := range h1.Data {
+		h1.Data[i] = Sigmoid(h)
+	}
+
+	ci.h1[c.h1Size] = 1
+	blas64.Gemv(blas.NoTrans, 1, ci.wy, blas64.Vector{Inc: 1, Data: ci.h1}, 0, blas64.Vector{Inc: 1, Data: ci.out})
+}
+
+func (ci *controller1Inference) output() []float64 {
+	return ci.out
+}
+
+func (ci *controller1Inference) reset() {}
+
+func (ci *controller1Inference) states() [][]float64 {
+	return nil
+}
+
+// controller1Inference32 is the float32 counterpart of controller1Inference.
+type controller1Inference32 struct {
+	c   *controller1
+	wh1 blas32.General
+	wy  blas32.General
+
+	readsX []float32
+	h1     []float32
+	out    []float32
+}
+
+func (c *controller1) inference32(weights []float32) controllerInference32 {
+	ci := controller1Inference32{
+		c:      c,
+		wh1:    general32(c.wh1Val(), weights, 0),
+		wy:     general32(c.wyVal(), weights, c.wyOffset()),
+		readsX: make([]float32, c.wh1Cols()),
+		h1:     make([]float32, c.h1Size+1),
+		out:    make([]float32, c.wyRows()),
+	}
+	return &ci
+}
+
+func (ci *controller1Inference32) forward(reads, x []float32) {
+	c := ci.c
+	copy(ci.readsX, reads)
+	copy(ci.readsX[len(reads):], x)
+	ci.readsX[len(ci.readsX)-1] = 1
+
+	h1 := blas32.Vector{Inc: 1, Data: ci.h1[0:c.h1Size]}
+	blas32.Gemv(blas.NoTrans, 1, ci.wh1, blas32.Vector{Inc: 1, Data: ci.readsX}, 0, h1)
+	for i, h := range h1.Data {
+		h1.Data[i] = sigmoid32(h)
+	}
+
+	ci.h1[c.h1Size] = 1
+	blas32.Gemv(blas.NoTrans, 1, ci.wy, blas32.Vector{Inc: 1, Data: ci.h1}, 0, blas32.Vector{Inc: 1, Data: ci.out})
+}
+
+func (ci *controller1Inference32) output() []float32 {
+	return ci.out
+}
+
+func (ci *controller1Inference32) reset() {}
+
 func (c *controller1) WeightsDesc(i int) string {
 	if i < c.wyOffset() {
 		return fmt.Sprintf("wh1[%d][%d]", i/c.wh1Cols(), i%c.wh1Cols())
@@ -226,20 +334,28 @@ func (c *controller1) WeightsDesc(i int) string {
 	}
 	if i < c.mtm1Offset() {
 		j := i - c.wtm1Offset()
-		return fmt.Sprintf("wtm1[%d][%d]", j/c.memoryN, j%c.memoryN)
+		return c.mems.wtm1Desc(j)
 	}
 	j := i - c.mtm1Offset()
-	return fmt.Sprintf("mtm1[%d][%d]", j/c.memoryM, j%c.memoryM)
+	return c.mems.mtm1Desc(j)
 }
 
 func (c *controller1) NumHeads() int {
-	return c.numHeads
+	return c.mems.numWeightings()
+}
+
+func (c *controller1) Memories() []MemorySpec {
+	return c.mems
+}
+
+func (c *controller1) spec() ControllerSpec {
+	return ControllerSpec{Type: Controller1Type, XSize: c.xSize, YSize: c.ySize, HSize: c.h1Size, Memories: append([]MemorySpec(nil), c.mems...)}
 }
 
 func (c *controller1) MemoryN() int {
-	return c.memoryN
+	return c.mems[0].N
 }
 
 func (c *controller1) MemoryM() int {
-	return c.memoryM
+	return c.mems[0].M
 }
@@ -63,6 +63,120 @@ func TestMultinomialModel(t *testing.T) {
 	checkGradients(t, c, Controller1Forward, x, model)
 }
 
+func TestConvShift(t *testing.T) {
+	times := 9
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	y := makeTensor2(times, 4)
+	for i := 0; i < len(y); i++ {
+		for j := 0; j < len(y[i]); j++ {
+			y[i][j] = rand.Float64()
+		}
+	}
+	h1Size := 3
+	mem := MemorySpec{N: 4, M: 2, NumHeads: 2, ShiftWidth: 3}
+	c := NewEmptyController1WithMemory(len(x[0]), len(y[0]), h1Size, mem)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &LogisticModel{Y: y}
+	ForwardBackward(c, x, model)
+	checkGradients(t, c, Controller1Forward, x, model)
+}
+
+func TestLRUA(t *testing.T) {
+	times := 9
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	y := makeTensor2(times, 4)
+	for i := 0; i < len(y); i++ {
+		for j := 0; j < len(y[i]); j++ {
+			y[i][j] = rand.Float64()
+		}
+	}
+	h1Size := 3
+	mem := MemorySpec{N: 5, M: 2, NumHeads: 2, LRUA: true, UsageDecay: 0.95}
+	c := NewEmptyController1WithMemory(len(x[0]), len(y[0]), h1Size, mem)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &LogisticModel{Y: y}
+	ForwardBackward(c, x, model)
+	checkForwardBackwardGradients(t, c, x, model)
+}
+
+func TestReadWriteHeads(t *testing.T) {
+	times := 9
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	y := makeTensor2(times, 4)
+	for i := 0; i < len(y); i++ {
+		for j := 0; j < len(y[i]); j++ {
+			y[i][j] = rand.Float64()
+		}
+	}
+	h1Size := 3
+	mem := MemorySpec{N: 3, M: 2, NumReadHeads: 3, NumWriteHeads: 1}
+	c := NewEmptyController1WithMemory(len(x[0]), len(y[0]), h1Size, mem)
+	if n, expected := mem.numHeadUnits(), 3*(2+3+1)+(3*2+3+1); n != expected {
+		t.Fatalf("%d head units, expected %d", n, expected)
+	}
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &LogisticModel{Y: y}
+	ForwardBackward(c, x, model)
+	checkGradients(t, c, Controller1Forward, x, model)
+}
+
+func TestKeyValueMemory(t *testing.T) {
+	times := 9
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	y := makeTensor2(times, 4)
+	for i := 0; i < len(y); i++ {
+		for j := 0; j < len(y[i]); j++ {
+			y[i][j] = rand.Float64()
+		}
+	}
+	h1Size := 3
+	mem := MemorySpec{N: 3, M: 4, NumHeads: 2, KeySize: 2}
+	c := NewEmptyController1WithMemory(len(x[0]), len(y[0]), h1Size, mem)
+	if n, expected := mem.numHeadUnits(), 2*(2*4+2+1+1+1+1); n != expected {
+		t.Fatalf("%d head units, expected %d", n, expected)
+	}
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &LogisticModel{Y: y}
+	ForwardBackward(c, x, model)
+	checkGradients(t, c, Controller1Forward, x, model)
+}
+
 // A ControllerForward is a ground truth implementation of the forward pass of a controller.
 type ControllerForward func(c Controller, reads [][]float64, x []float64) (prediction []float64, heads []*Head)
 
@@ -102,21 +216,21 @@ func Controller1Forward(c1 Controller, reads [][]float64, x []float64) ([]float6
 	for i := range prediction {
 		prediction[i] = out[i]
 	}
-	heads := make([]*Head, c.numHeads)
-	for i := range heads {
-		heads[i] = NewHead(c.memoryM)
-		hul := headUnitsLen(c.MemoryM())
-		heads[i].vals = make([]float64, hul)
-		heads[i].grads = make([]float64, hul)
-		for j := range heads[i].vals {
-			heads[i].vals[j] += out[c.ySize+i*hul+j]
-		}
-	}
+	heads := newControllerHeads(c.mems, out[c.ySize:])
 
 	return prediction, heads
 }
 
-func loss(c Controller, forward ControllerForward, in [][]float64, model DensityModel) float64 {
+// newControllerHeads creates heads from the output units of a ground truth forward pass.
+func newControllerHeads(mems memories, out []float64) []*Head {
+	vals := make([]float64, mems.numHeadUnits())
+	copy(vals, out)
+	return mems.newHeads(vals, make([]float64, len(vals)))
+}
+
+func loss(c Controller, newForward func() ControllerForward, in [][]float64, model DensityModel) float64 {
+	forward := newForward()
+
 	// Initialize memory as in the function ForwardBackward
 	mem := makeTensorUnit2(c.MemoryN(), c.MemoryM())
 	for i := range mem {
@@ -140,12 +254,13 @@ func loss(c Controller, forward ControllerForward, in [][]float64, model Density
 			wtm1s[i].TopVal[j] = wtm1s[i].TopVal[j] / sum
 		}
 	}
-	reads := makeTensor2(c.NumHeads(), c.MemoryM())
+	spec := controllerMemories(c)[0]
+	reads := makeTensor2(spec.numReads(), spec.readSize())
 	for i := 0; i < len(reads); i++ {
 		for j := 0; j < len(reads[i]); j++ {
 			var v float64 = 0
 			for k := 0; k < len(mem); k++ {
-				v += wtm1s[i].TopVal[k] * mem[k][j].Val
+				v += wtm1s[i].TopVal[k] * mem[k][spec.KeySize+j].Val
 			}
 			reads[i][j] = v
 		}
@@ -176,15 +291,25 @@ func computeDensity(timestep int, pred []float64, model DensityModel) []float64
 }
 
 func checkGradients(t *testing.T, c Controller, forward ControllerForward, in [][]float64, model DensityModel) {
-	lx := loss(c, forward, in, model)
+	checkRecurrentGradients(t, c, func() ControllerForward { return forward }, in, model)
+}
 
+// checkRecurrentGradients is like checkGradients, except that it calls newForward to obtain a fresh forward pass for each sequence.
+// This is required by controllers that keep states across time steps.
+func checkRecurrentGradients(t *testing.T, c Controller, newForward func() ControllerForward, in [][]float64, model DensityModel) {
 	for i, x := range c.WeightsVal() {
-		h := machineEpsilonSqrt * math.Max(math.Abs(x), 1)
+		// Use central differences, whose error is O(h^2) instead of the O(h) of forward differences.
+		// The loss is strongly curved for some random weights, such as those that make beta large, in which case
+		// forward differences exceed the tolerance below.
+		h := 1e-6 * math.Max(math.Abs(x), 1)
 		xph := x + h
 		c.WeightsVal()[i] = xph
-		lxph := loss(c, forward, in, model)
+		lxph := loss(c, newForward, in, model)
+		xmh := x - h
+		c.WeightsVal()[i] = xmh
+		lxmh := loss(c, newForward, in, model)
 		c.WeightsVal()[i] = x
-		grad := (lxph - lx) / (xph - x)
+		grad := (lxph - lxmh) / (xph - xmh)
 
 		wGrad := c.WeightsGrad()[i]
 		tag := c.WeightsDesc(i)
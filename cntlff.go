@@ -0,0 +1,449 @@
+package ntm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas32"
+	"github.com/gonum/blas/blas64"
+)
+
+// An Activation is the nonlinearity applied to the units of a layer.
+type Activation int
+
+const (
+	SigmoidActivation Activation = iota
+	TanhActivation
+	ReLUActivation
+)
+
+func (a Activation) String() string {
+	switch a {
+	case SigmoidActivation:
+		return "sigmoid"
+	case TanhActivation:
+		return "tanh"
+	case ReLUActivation:
+		return "relu"
+	}
+	return fmt.Sprintf("Activation(%d)", int(a))
+}
+
+func (a Activation) f(x float64) float64 {
+	switch a {
+	case TanhActivation:
+		return math.Tanh(x)
+	case ReLUActivation:
+		return math.Max(x, 0)
+	}
+	return Sigmoid(x)
+}
+
+// deriv returns the derivative of the activation, given its output y.
+func (a Activation) deriv(y float64) float64 {
+	switch a {
+	case TanhActivation:
+		return 1 - y*y
+	case ReLUActivation:
+		if y > 0 {
+			return 1
+		}
+		return 0
+	}
+	return y * (1 - y)
+}
+
+// A Layer describes a hidden layer of a feedforward controller.
+type Layer struct {
+	Size       int
+	Activation Activation
+}
+
+// feedforwardController is a feedforward network with an arbitrary number of hidden layers.
+// A feedforwardController with a single sigmoid layer has the same weights layout as controller1.
+type feedforwardController struct {
+	weightsVal  []float64
+	weightsGrad []float64
+
+	Reads     []*memRead
+	X         []float64
+	ReadsXVal blas64.Vector
+
+	// HVal and HGrad are the values and gradients of each hidden layer,
+	// each of which has an additional bias unit at its end.
+	HVal  [][]float64
+	HGrad [][]float64
+
+	heads   []*Head
+	outVal  []float64
+	outGrad []float64
+
+	layers []Layer
+	mems   memories
+	xSize  int
+	ySize  int
+}
+
+// layerCols returns the number of columns of the weights matrix of layer l.
+// The weights matrix of layer len(c.layers) is the one of the output layer.
+func (c *feedforwardController) layerCols(l int) int {
+	if l == 0 {
+		return c.mems.numReadUnits() + c.xSize + 1
+	}
+	return c.layers[l-1].Size + 1
+}
+
+func (c *feedforwardController) layerRows(l int) int {
+	if l == len(c.layers) {
+		return c.wyRows()
+	}
+	return c.layers[l].Size
+}
+
+func (c *feedforwardController) layerOffset(l int) int {
+	offset := 0
+	for i := 0; i < l; i++ {
+		offset += c.layerRows(i) * c.layerCols(i)
+	}
+	return offset
+}
+
+func (c *feedforwardController) wyRows() int {
+	return c.ySize + c.mems.numHeadUnits()
+}
+
+func (c *feedforwardController) wyOffset() int {
+	return c.layerOffset(len(c.layers))
+}
+
+func (c *feedforwardController) wtm1Offset() int {
+	return c.layerOffset(len(c.layers) + 1)
+}
+
+func (c *feedforwardController) mtm1Offset() int {
+	return c.wtm1Offset() + c.mems.numWtm1Units()
+}
+
+func (c *feedforwardController) numWeights() int {
+	return c.mtm1Offset() + c.mems.numMtm1Units()
+}
+
+func (c *feedforwardController) w(l int, w []float64) blas64.General {
+	m := blas64.General{
+		Rows: c.layerRows(l),
+		Cols: c.layerCols(l),
+	}
+	m.Stride = m.Cols
+	offset := c.layerOffset(l)
+	m.Data = w[offset : offset+m.Rows*m.Cols]
+	return m
+}
+
+func (c *feedforwardController) wVal(l int) blas64.General {
+	return c.w(l, c.weightsVal)
+}
+
+func (c *feedforwardController) wGrad(l int) blas64.General {
+	return c.w(l, c.weightsGrad)
+}
+
+func (c *feedforwardController) Wtm1BiasVal() []float64 {
+	return c.weightsVal[c.wtm1Offset():c.mtm1Offset()]
+}
+
+func (c *feedforwardController) Wtm1BiasGrad() []float64 {
+	return c.weightsGrad[c.wtm1Offset():c.mtm1Offset()]
+}
+
+func (c *feedforwardController) Mtm1BiasVal() []float64 {
+	return c.weightsVal[c.mtm1Offset():]
+}
+
+func (c *feedforwardController) Mtm1BiasGrad() []float64 {
+	return c.weightsGrad[c.mtm1Offset():]
+}
+
+// NewEmptyFeedforwardController returns a new feedforward controller whose hidden layers are given by layers.
+// The returned controller is empty in that all its network weights are initialized as 0.
+func NewEmptyFeedforwardController(xSize, ySize int, layers []Layer, numHeads, n, m int) *feedforwardController {
+	return NewEmptyFeedforwardControllerWithMemory(xSize, ySize, layers, MemorySpec{N: n, M: m, NumHeads: numHeads})
+}
+
+// NewEmptyFeedforwardControllerWithMemory is like NewEmptyFeedforwardController, except that the memory banks and their heads are described by mems.
+// The heads of the first bank come first, followed by those of the second bank and so on.
+func NewEmptyFeedforwardControllerWithMemory(xSize, ySize int, layers []Layer, mems ...MemorySpec) *feedforwardController {
+	c := feedforwardController{
+		layers: append([]Layer(nil), layers...),
+		mems:   mems,
+		xSize:  xSize,
+		ySize:  ySize,
+	}
+	c.weightsVal = make([]float64, c.numWeights())
+	c.weightsGrad = make([]float64, c.numWeights())
+	return &c
+}
+
+func (c *feedforwardController) Heads() []*Head {
+	return c.heads
+}
+
+func (c *feedforwardController) YVal() []float64 {
+	return c.outVal[0:c.ySize]
+}
+
+func (c *feedforwardController) YGrad() []float64 {
+	return c.outGrad[0:c.ySize]
+}
+
+func (old *feedforwardController) Forward(reads []*memRead, x []float64) Controller {
+	c := feedforwardController{
+		weightsVal:  old.weightsVal,
+		weightsGrad: old.weightsGrad,
+		Reads:       reads,
+		X:           x,
+		HVal:        make([][]float64, len(old.layers)),
+		HGrad:       make([][]float64, len(old.layers)),
+		outVal:      make([]float64, old.wyRows()),
+		outGrad:     make([]float64, old.wyRows()),
+
+		layers: old.layers,
+		mems:   old.mems,
+		xSize:  old.xSize,
+		ySize:  old.ySize,
+	}
+
+	ud := make([]float64, c.layerCols(0))
+	pos := 0
+	for _, read := range reads {
+		copy(ud[pos:], read.TopVal)
+		pos += len(read.TopVal)
+	}
+	copy(ud[c.mems.numReadUnits():], c.X)
+	ud[c.mems.numReadUnits()+c.xSize] = 1
+	c.ReadsXVal = blas64.Vector{Inc: 1, Data: ud}
+
+	in := c.ReadsXVal
+	for l, layer := range c.layers {
+		c.HVal[l] = make([]float64, layer.Size+1)
+		c.HGrad[l] = make([]float64, layer.Size+1)
+		h := blas64.Vector{Inc: 1, Data: c.HVal[l][0:layer.Size]}
+		blas64.Gemv(blas.NoTrans, 1, c.wVal(l), in, 1, h)
+		for i, v := range h.Data {
+			h.Data[i] = layer.Activation.f(v)
+		}
+		c.HVal[l][layer.Size] = 1
+		in = blas64.Vector{Inc: 1, Data: c.HVal[l]}
+	}
+
+	outV := blas64.Vector{Inc: 1, Data: c.outVal}
+	blas64.Gemv(blas.NoTrans, 1, c.wVal(len(c.layers)), in, 1, outV)
+
+	c.heads = c.mems.newHeads(c.outVal[c.ySize:], c.outGrad[c.ySize:])
+
+	return &c
+}
+
+func (c *feedforwardController) Backward() {
+	grad := blas64.Vector{Inc: 1, Data: c.outGrad}
+	for l := len(c.layers); l >= 0; l-- {
+		var inVal, inGrad blas64.Vector
+		if l == 0 {
+			inVal = c.ReadsXVal
+			inGrad = blas64.Vector{Inc: 1, Data: make([]float64, c.layerCols(0))}
+		} else {
+			inVal = blas64.Vector{Inc: 1, Data: c.HVal[l-1]}
+			inGrad = blas64.Vector{Inc: 1, Data: c.HGrad[l-1]}
+		}
+		blas64.Gemv(blas.Trans, 1, c.wVal(l), grad, 1, inGrad)
+		blas64.Ger(1, grad, inVal, c.wGrad(l))
+
+		if l == 0 {
+			pos := 0
+			for _, read := range c.Reads {
+				copy(read.TopGrad, inGrad.Data[pos:pos+len(read.TopGrad)])
+				pos += len(read.TopGrad)
+			}
+			break
+		}
+
+		layer := c.layers[l-1]
+		grad = blas64.Vector{Inc: 1, Data: c.HGrad[l-1][0:layer.Size]}
+		for i, v := range c.HVal[l-1][0:layer.Size] {
+			grad.Data[i] *= layer.Activation.deriv(v)
+		}
+	}
+}
+
+func (c *feedforwardController) WeightsVal() []float64 {
+	return c.weightsVal
+}
+
+func (c *feedforwardController) WeightsGrad() []float64 {
+	return c.weightsGrad
+}
+
+// WeightsDesc returns the description of a weight.
+// The weights of the hidden layers are named wh1, wh2, etc., and those of the output layer are named wy.
+func (c *feedforwardController) WithWeightsGrad(grad []float64) Controller {
+	cc := *c
+	cc.weightsGrad = grad
+	return &cc
+}
+
+func (c *feedforwardController) truncate() Controller {
+	cc := *c
+	cc.Reads = nil
+	cc.heads = nil
+	return &cc
+}
+
+// setGrads does nothing, since the controller carries no states across time steps.
+func (c *feedforwardController) setGrads(ck Controller) {}
+
+// feedforwardInference runs a feedforwardController forward with buffers that are reused across time steps.
+type feedforwardInference struct {
+	c *feedforwardController
+	// w are the weights of each layer of c, which are computed once since computing their layout allocates.
+	w []blas64.General
+
+	readsX []float64
+	h      [][]float64
+	out    []float64
+}
+
+func (c *feedforwardController) inference() controllerInference {
+	ci := feedforwardInference{
+		c:      c,
+		readsX: make([]float64, c.layerCols(0)),
+		h:      make([][]float64, len(c.layers)),
+		out:    make([]float64, c.wyRows()),
+	}
+	for l, layer := range c.layers {
+		ci.h[l] = make([]float64, layer.Size+1)
+	}
+	for l := 0; l <= len(c.layers); l++ {
+		ci.w = append(ci.w, c.wVal(l))
+	}
+	return &ci
+}
+
+func (ci *feedforwardInference) forward(reads, x []float64) {
+	c := ci.c
+	copy(ci.readsX, reads)
+	copy(ci.readsX[len(reads):], x)
+	ci.readsX[len(ci.readsX)-1] = 1
+
+	in := blas64.Vector{Inc: 1, Data: ci.readsX}
+	for l, layer := range c.layers {
+		h := blas64.Vector{Inc: 1, Data: ci.h[l][0:layer.Size]}
+		blas64.Gemv(blas.NoTrans, 1, ci.w[l], in, 0, h)
+		for i, v := range h.Data {
+			h.Data[i] = layer.Activation.f(v)
+		}
+		ci.h[l][layer.Size] = 1
+		in = blas64.Vector{Inc: 1, Data: ci.h[l]}
+	}
+	blas64.Gemv(blas.NoTrans, 1, ci.w[len(c.layers)], in, 0, blas64.Vector{Inc: 1, Data: ci.out})
+}
+
+func (ci *feedforwardInference) output() []float64 {
+	return ci.out
+}
+
+func (ci *feedforwardInference) reset() {}
+
+func (ci *feedforwardInference) states() [][]float64 {
+	return nil
+}
+
+// feedforwardInference32 is the float32 counterpart of feedforwardInference.
+type feedforwardInference32 struct {
+	c *feedforwardController
+	w []blas32.General
+
+	readsX []float32
+	h      [][]float32
+	out    []float32
+}
+
+func (c *feedforwardController) inference32(weights []float32) controllerInference32 {
+	ci := feedforwardInference32{
+		c:      c,
+		readsX: make([]float32, c.layerCols(0)),
+		h:      make([][]float32, len(c.layers)),
+		out:    make([]float32, c.wyRows()),
+	}
+	for l, layer := range c.layers {
+		ci.h[l] = make([]float32, layer.Size+1)
+	}
+	for l := 0; l <= len(c.layers); l++ {
+		ci.w = append(ci.w, general32(c.wVal(l), weights, c.layerOffset(l)))
+	}
+	return &ci
+}
+
+func (ci *feedforwardInference32) forward(reads, x []float32) {
+	c := ci.c
+	copy(ci.readsX, reads)
+	copy(ci.readsX[len(reads):], x)
+	ci.readsX[len(ci.readsX)-1] = 1
+
+	in := blas32.Vector{Inc: 1, Data: ci.readsX}
+	for l, layer := range c.layers {
+		h := blas32.Vector{Inc: 1, Data: ci.h[l][0:layer.Size]}
+		blas32.Gemv(blas.NoTrans, 1, ci.w[l], in, 0, h)
+		for i, v := range h.Data {
+			h.Data[i] = float32(layer.Activation.f(float64(v)))
+		}
+		ci.h[l][layer.Size] = 1
+		in = blas32.Vector{Inc: 1, Data: ci.h[l]}
+	}
+	blas32.Gemv(blas.NoTrans, 1, ci.w[len(c.layers)], in, 0, blas32.Vector{Inc: 1, Data: ci.out})
+}
+
+func (ci *feedforwardInference32) output() []float32 {
+	return ci.out
+}
+
+func (ci *feedforwardInference32) reset() {}
+
+func (c *feedforwardController) WeightsDesc(i int) string {
+	for l := 0; l <= len(c.layers); l++ {
+		if i >= c.layerOffset(l+1) {
+			continue
+		}
+		j := i - c.layerOffset(l)
+		cols := c.layerCols(l)
+		if l == len(c.layers) {
+			return fmt.Sprintf("wy[%d][%d]", j/cols, j%cols)
+		}
+		return fmt.Sprintf("wh%d[%d][%d]", l+1, j/cols, j%cols)
+	}
+	if i < c.mtm1Offset() {
+		j := i - c.wtm1Offset()
+		return c.mems.wtm1Desc(j)
+	}
+	j := i - c.mtm1Offset()
+	return c.mems.mtm1Desc(j)
+}
+
+func (c *feedforwardController) NumHeads() int {
+	return c.mems.numWeightings()
+}
+
+func (c *feedforwardController) Memories() []MemorySpec {
+	return c.mems
+}
+
+func (c *feedforwardController) spec() ControllerSpec {
+	return ControllerSpec{Type: FeedforwardType, XSize: c.xSize, YSize: c.ySize, Layers: append([]Layer(nil), c.layers...), Memories: append([]MemorySpec(nil), c.mems...)}
+}
+
+func (c *feedforwardController) MemoryN() int {
+	return c.mems[0].N
+}
+
+func (c *feedforwardController) MemoryM() int {
+	return c.mems[0].M
+}
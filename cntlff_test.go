@@ -0,0 +1,106 @@
+package ntm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFeedforwardController(t *testing.T) {
+	times := 9
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	outputSize := 4
+	y := make([]int, times)
+	for i := range y {
+		y[i] = rand.Intn(outputSize)
+	}
+	n := 3
+	m := 2
+	layers := []Layer{{Size: 3, Activation: TanhActivation}, {Size: 4, Activation: ReLUActivation}, {Size: 2, Activation: SigmoidActivation}}
+	numHeads := 2
+	c := NewEmptyFeedforwardController(len(x[0]), outputSize, layers, numHeads, n, m)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &MultinomialModel{Y: y}
+	ForwardBackward(c, x, model)
+	checkGradients(t, c, FeedforwardForward, x, model)
+}
+
+// TestFeedforwardController1 checks that a feedforward controller with a single sigmoid layer is equivalent to controller1.
+func TestFeedforwardController1(t *testing.T) {
+	xSize := 4
+	ySize := 3
+	h1Size := 3
+	numHeads := 2
+	n := 3
+	m := 2
+	c1 := NewEmptyController1(xSize, ySize, h1Size, numHeads, n, m)
+	ff := NewEmptyFeedforwardController(xSize, ySize, []Layer{{Size: h1Size, Activation: SigmoidActivation}}, numHeads, n, m)
+	if len(c1.WeightsVal()) != len(ff.WeightsVal()) {
+		t.Fatalf("number of weights %d != %d", len(ff.WeightsVal()), len(c1.WeightsVal()))
+	}
+	for i := range c1.WeightsVal() {
+		c1.WeightsVal()[i] = 2*rand.Float64() - 1
+		ff.WeightsVal()[i] = c1.WeightsVal()[i]
+		if c1.WeightsDesc(i) != ff.WeightsDesc(i) && i < c1.wyOffset() {
+			t.Errorf("weight %d is described as %s, expected %s", i, ff.WeightsDesc(i), c1.WeightsDesc(i))
+		}
+	}
+
+	x := makeTensor2(5, xSize)
+	for i := range x {
+		for j := range x[i] {
+			x[i][j] = rand.Float64()
+		}
+	}
+	p1 := Predictions(ForwardBackward(c1, x, &LogisticModel{Y: makeTensor2(len(x), ySize)}))
+	pff := Predictions(ForwardBackward(ff, x, &LogisticModel{Y: makeTensor2(len(x), ySize)}))
+	for i := range p1 {
+		for j := range p1[i] {
+			if math.Abs(p1[i][j]-pff[i][j]) > 1e-12 {
+				t.Errorf("prediction[%d][%d] %f != %f", i, j, pff[i][j], p1[i][j])
+			}
+		}
+	}
+}
+
+func FeedforwardForward(c1 Controller, reads [][]float64, x []float64) ([]float64, []*Head) {
+	c := c1.(*feedforwardController)
+	in := make([]float64, 0)
+	for _, read := range reads {
+		in = append(in, read...)
+	}
+	in = append(in, x...)
+	in = append(in, 1)
+
+	var out []float64
+	for l := 0; l <= len(c.layers); l++ {
+		w := c.wVal(l)
+		out = make([]float64, w.Rows)
+		for i := range out {
+			var v float64 = 0
+			for j, u := range in {
+				v += w.Data[i*w.Cols+j] * u
+			}
+			if l < len(c.layers) {
+				v = c.layers[l].Activation.f(v)
+			}
+			out[i] = v
+		}
+		in = append(out, 1)
+	}
+
+	prediction := make([]float64, c.ySize)
+	copy(prediction, out)
+	heads := newControllerHeads(c.mems, out[c.ySize:])
+
+	return prediction, heads
+}
@@ -0,0 +1,521 @@
+package ntm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas32"
+	"github.com/gonum/blas/blas64"
+)
+
+// gruController is a controller with a single GRU layer.
+// Like lstmController, the hidden state of the GRU layer is carried from one time step to the next.
+type gruController struct {
+	weightsVal  []float64
+	weightsGrad []float64
+
+	prev *gruController // the controller at time t-1
+
+	Reads []*memRead
+	X     []float64
+	// ReadsXVal is the concatenation of reads, x, the previous hidden state and a bias unit,
+	// which is the input to the update and reset gates.
+	ReadsXVal blas64.Vector
+	// ReadsXRVal is the same as ReadsXVal except that the previous hidden state is multiplied by the reset gate,
+	// which is the input to the candidate hidden state.
+	ReadsXRVal blas64.Vector
+
+	// The gates are laid out as |-- update --|-- reset --|.
+	GatesVal  []float64
+	GatesGrad []float64
+	CandVal   []float64 // the candidate hidden state
+	HVal      []float64
+	HGrad     []float64
+
+	heads   []*Head
+	outVal  []float64
+	outGrad []float64
+
+	mems  memories
+	xSize int
+	hSize int
+	ySize int
+}
+
+func (c *gruController) whCols() int {
+	return c.mems.numReadUnits() + c.xSize + c.hSize + 1
+}
+
+func (c *gruController) wyRows() int {
+	return c.ySize + c.mems.numHeadUnits()
+}
+
+func (c *gruController) wcOffset() int {
+	return 2 * c.hSize * c.whCols()
+}
+
+func (c *gruController) wyOffset() int {
+	return 3 * c.hSize * c.whCols()
+}
+
+func (c *gruController) wtm1Offset() int {
+	return c.wyOffset() + c.wyRows()*(c.hSize+1)
+}
+
+func (c *gruController) mtm1Offset() int {
+	return c.wtm1Offset() + c.mems.numWtm1Units()
+}
+
+func (c *gruController) numWeights() int {
+	return c.mtm1Offset() + c.mems.numMtm1Units()
+}
+
+// wg returns the weights of the update and reset gates.
+func (c *gruController) wg(w []float64) blas64.General {
+	m := blas64.General{
+		Rows: 2 * c.hSize,
+		Cols: c.whCols(),
+	}
+	m.Stride = m.Cols
+	m.Data = w[0:c.wcOffset()]
+	return m
+}
+
+func (c *gruController) wgVal() blas64.General {
+	return c.wg(c.weightsVal)
+}
+
+func (c *gruController) wgGrad() blas64.General {
+	return c.wg(c.weightsGrad)
+}
+
+// wc returns the weights of the candidate hidden state.
+func (c *gruController) wc(w []float64) blas64.General {
+	m := blas64.General{
+		Rows: c.hSize,
+		Cols: c.whCols(),
+	}
+	m.Stride = m.Cols
+	m.Data = w[c.wcOffset():c.wyOffset()]
+	return m
+}
+
+func (c *gruController) wcVal() blas64.General {
+	return c.wc(c.weightsVal)
+}
+
+func (c *gruController) wcGrad() blas64.General {
+	return c.wc(c.weightsGrad)
+}
+
+func (c *gruController) wy(w []float64) blas64.General {
+	m := blas64.General{
+		Rows: c.wyRows(),
+		Cols: c.hSize + 1,
+	}
+	m.Stride = m.Cols
+	m.Data = w[c.wyOffset():c.wtm1Offset()]
+	return m
+}
+
+func (c *gruController) wyVal() blas64.General {
+	return c.wy(c.weightsVal)
+}
+
+func (c *gruController) wyGrad() blas64.General {
+	return c.wy(c.weightsGrad)
+}
+
+func (c *gruController) Wtm1BiasVal() []float64 {
+	return c.weightsVal[c.wtm1Offset():c.mtm1Offset()]
+}
+
+func (c *gruController) Wtm1BiasGrad() []float64 {
+	return c.weightsGrad[c.wtm1Offset():c.mtm1Offset()]
+}
+
+func (c *gruController) Mtm1BiasVal() []float64 {
+	return c.weightsVal[c.mtm1Offset():]
+}
+
+func (c *gruController) Mtm1BiasGrad() []float64 {
+	return c.weightsGrad[c.mtm1Offset():]
+}
+
+// NewEmptyGRUController returns a new controller with a single GRU layer of size hSize.
+// The returned controller is empty in that all its network weights are initialized as 0,
+// and the hidden state of its GRU layer starts from 0.
+func NewEmptyGRUController(xSize, ySize, hSize, numHeads, n, m int) *gruController {
+	return NewEmptyGRUControllerWithMemory(xSize, ySize, hSize, MemorySpec{N: n, M: m, NumHeads: numHeads})
+}
+
+// NewEmptyGRUControllerWithMemory is like NewEmptyGRUController, except that the memory banks and their heads are described by mems.
+// The heads of the first bank come first, followed by those of the second bank and so on.
+func NewEmptyGRUControllerWithMemory(xSize, ySize, hSize int, mems ...MemorySpec) *gruController {
+	c := gruController{
+		mems:  mems,
+		xSize: xSize,
+		hSize: hSize,
+		ySize: ySize,
+	}
+	c.weightsVal = make([]float64, c.numWeights())
+	c.weightsGrad = make([]float64, c.numWeights())
+	return &c
+}
+
+func (c *gruController) Heads() []*Head {
+	return c.heads
+}
+
+func (c *gruController) YVal() []float64 {
+	return c.outVal[0:c.ySize]
+}
+
+func (c *gruController) YGrad() []float64 {
+	return c.outGrad[0:c.ySize]
+}
+
+// hPrevVal returns the hidden state at time t-1.
+func (c *gruController) hPrevVal() []float64 {
+	if c.prev == nil {
+		return make([]float64, c.hSize)
+	}
+	return c.prev.HVal[0:c.hSize]
+}
+
+func (old *gruController) Forward(reads []*memRead, x []float64) Controller {
+	c := gruController{
+		weightsVal:  old.weightsVal,
+		weightsGrad: old.weightsGrad,
+		Reads:       reads,
+		X:           x,
+		GatesVal:    make([]float64, 2*old.hSize),
+		GatesGrad:   make([]float64, 2*old.hSize),
+		CandVal:     make([]float64, old.hSize),
+		HVal:        make([]float64, old.hSize+1),
+		HGrad:       make([]float64, old.hSize+1),
+		outVal:      make([]float64, old.wyRows()),
+		outGrad:     make([]float64, old.wyRows()),
+
+		mems:  old.mems,
+		xSize: old.xSize,
+		hSize: old.hSize,
+		ySize: old.ySize,
+	}
+	// The empty controller carries no states, in which case the previous hidden state is 0.
+	if old.HVal != nil {
+		c.prev = old
+	}
+	h := c.hSize
+	hStart := c.mems.numReadUnits() + c.xSize
+	hPrev := c.hPrevVal()
+
+	ud := make([]float64, c.whCols())
+	pos := 0
+	for _, read := range reads {
+		copy(ud[pos:], read.TopVal)
+		pos += len(read.TopVal)
+	}
+	copy(ud[c.mems.numReadUnits():], c.X)
+	copy(ud[hStart:], hPrev)
+	ud[c.whCols()-1] = 1
+	c.ReadsXVal = blas64.Vector{Inc: 1, Data: ud}
+
+	gates := blas64.Vector{Inc: 1, Data: c.GatesVal}
+	blas64.Gemv(blas.NoTrans, 1, c.wgVal(), c.ReadsXVal, 1, gates)
+	for i, v := range c.GatesVal {
+		c.GatesVal[i] = Sigmoid(v)
+	}
+
+	udr := make([]float64, c.whCols())
+	copy(udr, ud)
+	for i := 0; i < h; i++ {
+		udr[hStart+i] *= c.GatesVal[h+i]
+	}
+	c.ReadsXRVal = blas64.Vector{Inc: 1, Data: udr}
+
+	cand := blas64.Vector{Inc: 1, Data: c.CandVal}
+	blas64.Gemv(blas.NoTrans, 1, c.wcVal(), c.ReadsXRVal, 1, cand)
+	for i, v := range c.CandVal {
+		c.CandVal[i] = math.Tanh(v)
+		z := c.GatesVal[i]
+		c.HVal[i] = (1-z)*hPrev[i] + z*c.CandVal[i]
+	}
+
+	c.HVal[h] = 1
+	hv := blas64.Vector{Inc: 1, Data: c.HVal}
+	outV := blas64.Vector{Inc: 1, Data: c.outVal}
+	blas64.Gemv(blas.NoTrans, 1, c.wyVal(), hv, 1, outV)
+
+	c.heads = c.mems.newHeads(c.outVal[c.ySize:], c.outGrad[c.ySize:])
+
+	return &c
+}
+
+// Backward performs a backward pass.
+// Besides the gradients on Heads and Y, it assumes that the gradients on the hidden state have been
+// propagated from the controller at time t+1.
+func (c *gruController) Backward() {
+	out := blas64.Vector{Inc: 1, Data: c.outGrad}
+	hVal := blas64.Vector{Inc: 1, Data: c.HVal}
+	hGrad := blas64.Vector{Inc: 1, Data: c.HGrad}
+	blas64.Gemv(blas.Trans, 1, c.wyVal(), out, 1, hGrad)
+	blas64.Ger(1, out, hVal, c.wyGrad())
+
+	h := c.hSize
+	hStart := c.mems.numReadUnits() + c.xSize
+	hPrev := c.hPrevVal()
+	hPrevGrad := make([]float64, h)
+
+	candGrad := blas64.Vector{Inc: 1, Data: make([]float64, h)}
+	for i := 0; i < h; i++ {
+		z := c.GatesVal[i]
+		cv := c.CandVal[i]
+		candGrad.Data[i] = c.HGrad[i] * z * (1 - cv*cv)
+		c.GatesGrad[i] = c.HGrad[i] * (cv - hPrev[i]) * z * (1 - z)
+		hPrevGrad[i] += c.HGrad[i] * (1 - z)
+	}
+
+	ur := blas64.Vector{Inc: 1, Data: make([]float64, c.whCols())}
+	blas64.Gemv(blas.Trans, 1, c.wcVal(), candGrad, 1, ur)
+	blas64.Ger(1, candGrad, c.ReadsXRVal, c.wcGrad())
+	for i := 0; i < h; i++ {
+		r := c.GatesVal[h+i]
+		g := ur.Data[hStart+i]
+		c.GatesGrad[h+i] = g * hPrev[i] * r * (1 - r)
+		hPrevGrad[i] += g * r
+	}
+
+	gatesGrad := blas64.Vector{Inc: 1, Data: c.GatesGrad}
+	u := blas64.Vector{Inc: 1, Data: make([]float64, c.whCols())}
+	blas64.Gemv(blas.Trans, 1, c.wgVal(), gatesGrad, 1, u)
+	blas64.Ger(1, gatesGrad, c.ReadsXVal, c.wgGrad())
+
+	pos := 0
+	for _, read := range c.Reads {
+		for j := range read.TopGrad {
+			read.TopGrad[j] = u.Data[pos+j] + ur.Data[pos+j]
+		}
+		pos += len(read.TopGrad)
+	}
+	if c.prev != nil {
+		for i, g := range u.Data[hStart : hStart+h] {
+			c.prev.HGrad[i] += g + hPrevGrad[i]
+		}
+	}
+}
+
+func (c *gruController) WeightsVal() []float64 {
+	return c.weightsVal
+}
+
+func (c *gruController) WeightsGrad() []float64 {
+	return c.weightsGrad
+}
+
+func (c *gruController) WithWeightsGrad(grad []float64) Controller {
+	cc := *c
+	cc.weightsGrad = grad
+	return &cc
+}
+
+func (c *gruController) truncate() Controller {
+	cc := *c
+	cc.prev = nil
+	cc.Reads = nil
+	cc.heads = nil
+	return &cc
+}
+
+func (c *gruController) setGrads(ck Controller) {
+	copy(c.HGrad, ck.(*gruController).HGrad)
+}
+
+// gruInference runs a gruController forward with buffers that are reused across time steps.
+type gruInference struct {
+	c *gruController
+	// wg, wc and wy are the weights of c, which are computed once since computing their layout allocates.
+	wg blas64.General
+	wc blas64.General
+	wy blas64.General
+
+	readsX  []float64 // the reads, x, the hidden state at time t-1 and a bias unit
+	readsXR []float64
+	gates   []float64
+	cand    []float64
+	h       []float64
+	out     []float64
+}
+
+func (c *gruController) inference() controllerInference {
+	ci := gruInference{
+		c:       c,
+		wg:      c.wgVal(),
+		wc:      c.wcVal(),
+		wy:      c.wyVal(),
+		readsX:  make([]float64, c.whCols()),
+		readsXR: make([]float64, c.whCols()),
+		gates:   make([]float64, 2*c.hSize),
+		cand:    make([]float64, c.hSize),
+		h:       make([]float64, c.hSize+1),
+		out:     make([]float64, c.wyRows()),
+	}
+	return &ci
+}
+
+func (ci *gruInference) forward(reads, x []float64) {
+	c := ci.c
+	h := c.hSize
+	hStart := c.mems.numReadUnits() + c.xSize
+	hPrev := ci.readsX[hStart : hStart+h]
+	copy(ci.readsX, reads)
+	copy(ci.readsX[len(reads):], x)
+	copy(hPrev, ci.h[0:h])
+	ci.readsX[len(ci.readsX)-1] = 1
+
+	blas64.Gemv(blas.NoTrans, 1, ci.wg, blas64.Vector{Inc: 1, Data: ci.readsX}, 0, blas64.Vector{Inc: 1, Data: ci.gates})
+	for i, v := range ci.gates {
+		ci.gates[i] = Sigmoid(v)
+	}
+
+	copy(ci.readsXR, ci.readsX)
+	for i := 0; i < h; i++ {
+		ci.readsXR[hStart+i] *= ci.gates[h+i]
+	}
+	blas64.Gemv(blas.NoTrans, 1, ci.wc, blas64.Vector{Inc: 1, Data: ci.readsXR}, 0, blas64.Vector{Inc: 1, Data: ci.cand})
+	for i, v := range ci.cand {
+		ci.cand[i] = math.Tanh(v)
+		z := ci.gates[i]
+		ci.h[i] = (1-z)*hPrev[i] + z*ci.cand[i]
+	}
+
+	ci.h[h] = 1
+	blas64.Gemv(blas.NoTrans, 1, ci.wy, blas64.Vector{Inc: 1, Data: ci.h}, 0, blas64.Vector{Inc: 1, Data: ci.out})
+}
+
+func (ci *gruInference) output() []float64 {
+	return ci.out
+}
+
+func (ci *gruInference) reset() {
+	for i := range ci.h {
+		ci.h[i] = 0
+	}
+}
+
+func (ci *gruInference) states() [][]float64 {
+	return [][]float64{ci.h}
+}
+
+// gruInference32 is the float32 counterpart of gruInference.
+type gruInference32 struct {
+	c  *gruController
+	wg blas32.General
+	wc blas32.General
+	wy blas32.General
+
+	readsX  []float32
+	readsXR []float32
+	gates   []float32
+	cand    []float32
+	h       []float32
+	out     []float32
+}
+
+func (c *gruController) inference32(weights []float32) controllerInference32 {
+	ci := gruInference32{
+		c:       c,
+		wg:      general32(c.wgVal(), weights, 0),
+		wc:      general32(c.wcVal(), weights, c.wcOffset()),
+		wy:      general32(c.wyVal(), weights, c.wyOffset()),
+		readsX:  make([]float32, c.whCols()),
+		readsXR: make([]float32, c.whCols()),
+		gates:   make([]float32, 2*c.hSize),
+		cand:    make([]float32, c.hSize),
+		h:       make([]float32, c.hSize+1),
+		out:     make([]float32, c.wyRows()),
+	}
+	return &ci
+}
+
+func (ci *gruInference32) forward(reads, x []float32) {
+	c := ci.c
+	h := c.hSize
+	hStart := c.mems.numReadUnits() + c.xSize
+	hPrev := ci.readsX[hStart : hStart+h]
+	copy(ci.readsX, reads)
+	copy(ci.readsX[len(reads):], x)
+	copy(hPrev, ci.h[0:h])
+	ci.readsX[len(ci.readsX)-1] = 1
+
+	blas32.Gemv(blas.NoTrans, 1, ci.wg, blas32.Vector{Inc: 1, Data: ci.readsX}, 0, blas32.Vector{Inc: 1, Data: ci.gates})
+	for i, v := range ci.gates {
+		ci.gates[i] = sigmoid32(v)
+	}
+
+	copy(ci.readsXR, ci.readsX)
+	for i := 0; i < h; i++ {
+		ci.readsXR[hStart+i] *= ci.gates[h+i]
+	}
+	blas32.Gemv(blas.NoTrans, 1, ci.wc, blas32.Vector{Inc: 1, Data: ci.readsXR}, 0, blas32.Vector{Inc: 1, Data: ci.cand})
+	for i, v := range ci.cand {
+		ci.cand[i] = tanh32(v)
+		z := ci.gates[i]
+		ci.h[i] = (1-z)*hPrev[i] + z*ci.cand[i]
+	}
+
+	ci.h[h] = 1
+	blas32.Gemv(blas.NoTrans, 1, ci.wy, blas32.Vector{Inc: 1, Data: ci.h}, 0, blas32.Vector{Inc: 1, Data: ci.out})
+}
+
+func (ci *gruInference32) output() []float32 {
+	return ci.out
+}
+
+func (ci *gruInference32) reset() {
+	for i := range ci.h {
+		ci.h[i] = 0
+	}
+}
+
+func (c *gruController) WeightsDesc(i int) string {
+	if i < c.wcOffset() {
+		return fmt.Sprintf("wg[%d][%d]", i/c.whCols(), i%c.whCols())
+	}
+	if i < c.wyOffset() {
+		j := i - c.wcOffset()
+		return fmt.Sprintf("wc[%d][%d]", j/c.whCols(), j%c.whCols())
+	}
+	if i < c.wtm1Offset() {
+		j := i - c.wyOffset()
+		cols := c.hSize + 1
+		return fmt.Sprintf("wy[%d][%d]", j/cols, j%cols)
+	}
+	if i < c.mtm1Offset() {
+		j := i - c.wtm1Offset()
+		return c.mems.wtm1Desc(j)
+	}
+	j := i - c.mtm1Offset()
+	return c.mems.mtm1Desc(j)
+}
+
+func (c *gruController) NumHeads() int {
+	return c.mems.numWeightings()
+}
+
+func (c *gruController) Memories() []MemorySpec {
+	return c.mems
+}
+
+func (c *gruController) spec() ControllerSpec {
+	return ControllerSpec{Type: GRUType, XSize: c.xSize, YSize: c.ySize, HSize: c.hSize, Memories: append([]MemorySpec(nil), c.mems...)}
+}
+
+func (c *gruController) MemoryN() int {
+	return c.mems[0].N
+}
+
+func (c *gruController) MemoryM() int {
+	return c.mems[0].M
+}
@@ -0,0 +1,97 @@
+package ntm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGRUController(t *testing.T) {
+	times := 9
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	y := makeTensor2(times, 4)
+	for i := 0; i < len(y); i++ {
+		for j := 0; j < len(y[i]); j++ {
+			y[i][j] = rand.Float64()
+		}
+	}
+	n := 3
+	m := 2
+	hSize := 3
+	numHeads := 2
+	c := NewEmptyGRUController(len(x[0]), len(y[0]), hSize, numHeads, n, m)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &LogisticModel{Y: y}
+	ForwardBackward(c, x, model)
+	checkRecurrentGradients(t, c, NewGRUForward, x, model)
+}
+
+// NewGRUForward returns a ground truth forward pass of a gruController,
+// which keeps the hidden state of the GRU layer across time steps.
+func NewGRUForward() ControllerForward {
+	var hPrev []float64
+	return func(c1 Controller, reads [][]float64, x []float64) ([]float64, []*Head) {
+		c := c1.(*gruController)
+		if hPrev == nil {
+			hPrev = make([]float64, c.hSize)
+		}
+		readX := make([]float64, 0)
+		for _, read := range reads {
+			readX = append(readX, read...)
+		}
+		readX = append(readX, x...)
+
+		wg := c.wgVal()
+		in := append(append(append([]float64{}, readX...), hPrev...), 1)
+		gates := make([]float64, 2*c.hSize)
+		for i := range gates {
+			var v float64 = 0
+			for j, u := range in {
+				v += wg.Data[i*wg.Cols+j] * u
+			}
+			gates[i] = Sigmoid(v)
+		}
+
+		wc := c.wcVal()
+		in = append([]float64{}, readX...)
+		for i, hp := range hPrev {
+			in = append(in, gates[c.hSize+i]*hp)
+		}
+		in = append(in, 1)
+		h := make([]float64, c.hSize)
+		for i := range h {
+			var v float64 = 0
+			for j, u := range in {
+				v += wc.Data[i*wc.Cols+j] * u
+			}
+			z := gates[i]
+			h[i] = (1-z)*hPrev[i] + z*math.Tanh(v)
+		}
+		hPrev = h
+
+		out := make([]float64, c.wyRows())
+		wy := c.wyVal()
+		h = append(append([]float64{}, h...), 1)
+		for i := range out {
+			var v float64 = 0
+			for j, hv := range h {
+				v += wy.Data[i*wy.Cols+j] * hv
+			}
+			out[i] = v
+		}
+		prediction := make([]float64, c.ySize)
+		copy(prediction, out)
+		heads := newControllerHeads(c.mems, out[c.ySize:])
+
+		return prediction, heads
+	}
+}
@@ -0,0 +1,458 @@
+package ntm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas32"
+	"github.com/gonum/blas/blas64"
+)
+
+// lstmController is a controller with a single LSTM layer.
+// The hidden and cell states of the LSTM layer are carried from one time step to the next,
+// in the same way the memRead vectors are carried by the NTM.
+type lstmController struct {
+	weightsVal  []float64
+	weightsGrad []float64
+
+	prev *lstmController // the controller at time t-1
+
+	Reads     []*memRead
+	X         []float64
+	ReadsXVal blas64.Vector // the concatenation of reads, x, the previous hidden state and a bias unit
+
+	// The gates are laid out as |-- input --|-- forget --|-- output --|-- candidate --|.
+	GatesVal  []float64
+	GatesGrad []float64
+	CVal      []float64
+	CGrad     []float64
+	HVal      []float64
+	HGrad     []float64
+
+	heads   []*Head
+	outVal  []float64
+	outGrad []float64
+
+	mems  memories
+	xSize int
+	hSize int
+	ySize int
+}
+
+func (c *lstmController) whCols() int {
+	return c.mems.numReadUnits() + c.xSize + c.hSize + 1
+}
+
+func (c *lstmController) wyRows() int {
+	return c.ySize + c.mems.numHeadUnits()
+}
+
+func (c *lstmController) wyOffset() int {
+	return 4 * c.hSize * c.whCols()
+}
+
+func (c *lstmController) wtm1Offset() int {
+	return c.wyOffset() + c.wyRows()*(c.hSize+1)
+}
+
+func (c *lstmController) mtm1Offset() int {
+	return c.wtm1Offset() + c.mems.numWtm1Units()
+}
+
+func (c *lstmController) numWeights() int {
+	return c.mtm1Offset() + c.mems.numMtm1Units()
+}
+
+func (c *lstmController) wh(w []float64) blas64.General {
+	m := blas64.General{
+		Rows: 4 * c.hSize,
+		Cols: c.whCols(),
+	}
+	m.Stride = m.Cols
+	m.Data = w[0:c.wyOffset()]
+	return m
+}
+
+func (c *lstmController) whVal() blas64.General {
+	return c.wh(c.weightsVal)
+}
+
+func (c *lstmController) whGrad() blas64.General {
+	return c.wh(c.weightsGrad)
+}
+
+func (c *lstmController) wy(w []float64) blas64.General {
+	m := blas64.General{
+		Rows: c.wyRows(),
+		Cols: c.hSize + 1,
+	}
+	m.Stride = m.Cols
+	m.Data = w[c.wyOffset():c.wtm1Offset()]
+	return m
+}
+
+func (c *lstmController) wyVal() blas64.General {
+	return c.wy(c.weightsVal)
+}
+
+func (c *lstmController) wyGrad() blas64.General {
+	return c.wy(c.weightsGrad)
+}
+
+func (c *lstmController) Wtm1BiasVal() []float64 {
+	return c.weightsVal[c.wtm1Offset():c.mtm1Offset()]
+}
+
+func (c *lstmController) Wtm1BiasGrad() []float64 {
+	return c.weightsGrad[c.wtm1Offset():c.mtm1Offset()]
+}
+
+func (c *lstmController) Mtm1BiasVal() []float64 {
+	return c.weightsVal[c.mtm1Offset():]
+}
+
+func (c *lstmController) Mtm1BiasGrad() []float64 {
+	return c.weightsGrad[c.mtm1Offset():]
+}
+
+// NewEmptyLSTMController returns a new controller with a single LSTM layer of size hSize.
+// The returned controller is empty in that all its network weights are initialized as 0,
+// and the hidden and cell states of its LSTM layer start from 0.
+func NewEmptyLSTMController(xSize, ySize, hSize, numHeads, n, m int) *lstmController {
+	return NewEmptyLSTMControllerWithMemory(xSize, ySize, hSize, MemorySpec{N: n, M: m, NumHeads: numHeads})
+}
+
+// NewEmptyLSTMControllerWithMemory is like NewEmptyLSTMController, except that the memory banks and their heads are described by mems.
+// The heads of the first bank come first, followed by those of the second bank and so on.
+func NewEmptyLSTMControllerWithMemory(xSize, ySize, hSize int, mems ...MemorySpec) *lstmController {
+	c := lstmController{
+		mems:  mems,
+		xSize: xSize,
+		hSize: hSize,
+		ySize: ySize,
+	}
+	c.weightsVal = make([]float64, c.numWeights())
+	c.weightsGrad = make([]float64, c.numWeights())
+	return &c
+}
+
+func (c *lstmController) Heads() []*Head {
+	return c.heads
+}
+
+func (c *lstmController) YVal() []float64 {
+	return c.outVal[0:c.ySize]
+}
+
+func (c *lstmController) YGrad() []float64 {
+	return c.outGrad[0:c.ySize]
+}
+
+func (old *lstmController) Forward(reads []*memRead, x []float64) Controller {
+	c := lstmController{
+		weightsVal:  old.weightsVal,
+		weightsGrad: old.weightsGrad,
+		Reads:       reads,
+		X:           x,
+		GatesVal:    make([]float64, 4*old.hSize),
+		GatesGrad:   make([]float64, 4*old.hSize),
+		CVal:        make([]float64, old.hSize),
+		CGrad:       make([]float64, old.hSize),
+		HVal:        make([]float64, old.hSize+1),
+		HGrad:       make([]float64, old.hSize+1),
+		outVal:      make([]float64, old.wyRows()),
+		outGrad:     make([]float64, old.wyRows()),
+
+		mems:  old.mems,
+		xSize: old.xSize,
+		hSize: old.hSize,
+		ySize: old.ySize,
+	}
+	// The empty controller carries no states, in which case the previous states are all 0.
+	if old.HVal != nil {
+		c.prev = old
+	}
+
+	ud := make([]float64, c.whCols())
+	pos := 0
+	for _, read := range reads {
+		copy(ud[pos:], read.TopVal)
+		pos += len(read.TopVal)
+	}
+	copy(ud[c.mems.numReadUnits():], c.X)
+	if c.prev != nil {
+		copy(ud[c.mems.numReadUnits()+c.xSize:], c.prev.HVal[0:c.hSize])
+	}
+	ud[c.whCols()-1] = 1
+	c.ReadsXVal = blas64.Vector{Inc: 1, Data: ud}
+
+	gates := blas64.Vector{Inc: 1, Data: c.GatesVal}
+	blas64.Gemv(blas.NoTrans, 1, c.whVal(), c.ReadsXVal, 1, gates)
+	h := c.hSize
+	for i := 0; i < 3*h; i++ {
+		c.GatesVal[i] = Sigmoid(c.GatesVal[i])
+	}
+	for i := 3 * h; i < 4*h; i++ {
+		c.GatesVal[i] = math.Tanh(c.GatesVal[i])
+	}
+
+	for i := 0; i < h; i++ {
+		c.CVal[i] = c.GatesVal[i] * c.GatesVal[3*h+i]
+		if c.prev != nil {
+			c.CVal[i] += c.GatesVal[h+i] * c.prev.CVal[i]
+		}
+		c.HVal[i] = c.GatesVal[2*h+i] * math.Tanh(c.CVal[i])
+	}
+
+	c.HVal[h] = 1
+	hv := blas64.Vector{Inc: 1, Data: c.HVal}
+	outV := blas64.Vector{Inc: 1, Data: c.outVal}
+	blas64.Gemv(blas.NoTrans, 1, c.wyVal(), hv, 1, outV)
+
+	c.heads = c.mems.newHeads(c.outVal[c.ySize:], c.outGrad[c.ySize:])
+
+	return &c
+}
+
+// Backward performs a backward pass.
+// Besides the gradients on Heads and Y, it assumes that the gradients on the hidden and cell states have been
+// propagated from the controller at time t+1.
+func (c *lstmController) Backward() {
+	out := blas64.Vector{Inc: 1, Data: c.outGrad}
+	hVal := blas64.Vector{Inc: 1, Data: c.HVal}
+	hGrad := blas64.Vector{Inc: 1, Data: c.HGrad}
+	blas64.Gemv(blas.Trans, 1, c.wyVal(), out, 1, hGrad)
+	blas64.Ger(1, out, hVal, c.wyGrad())
+
+	h := c.hSize
+	for i := 0; i < h; i++ {
+		in := c.GatesVal[i]
+		f := c.GatesVal[h+i]
+		o := c.GatesVal[2*h+i]
+		g := c.GatesVal[3*h+i]
+		tc := math.Tanh(c.CVal[i])
+
+		c.CGrad[i] += c.HGrad[i] * o * (1 - tc*tc)
+		c.GatesGrad[i] = c.CGrad[i] * g * in * (1 - in)
+		if c.prev != nil {
+			c.GatesGrad[h+i] = c.CGrad[i] * c.prev.CVal[i] * f * (1 - f)
+			c.prev.CGrad[i] += c.CGrad[i] * f
+		}
+		c.GatesGrad[2*h+i] = c.HGrad[i] * tc * o * (1 - o)
+		c.GatesGrad[3*h+i] = c.CGrad[i] * in * (1 - g*g)
+	}
+
+	gatesGrad := blas64.Vector{Inc: 1, Data: c.GatesGrad}
+	u := blas64.Vector{Inc: 1, Data: make([]float64, c.whCols())}
+	blas64.Gemv(blas.Trans, 1, c.whVal(), gatesGrad, 1, u)
+	blas64.Ger(1, gatesGrad, c.ReadsXVal, c.whGrad())
+
+	pos := 0
+	for _, read := range c.Reads {
+		copy(read.TopGrad, u.Data[pos:pos+len(read.TopGrad)])
+		pos += len(read.TopGrad)
+	}
+	if c.prev != nil {
+		start := c.mems.numReadUnits() + c.xSize
+		for i, g := range u.Data[start : start+h] {
+			c.prev.HGrad[i] += g
+		}
+	}
+}
+
+func (c *lstmController) WeightsVal() []float64 {
+	return c.weightsVal
+}
+
+func (c *lstmController) WeightsGrad() []float64 {
+	return c.weightsGrad
+}
+
+func (c *lstmController) WithWeightsGrad(grad []float64) Controller {
+	cc := *c
+	cc.weightsGrad = grad
+	return &cc
+}
+
+func (c *lstmController) truncate() Controller {
+	cc := *c
+	cc.prev = nil
+	cc.Reads = nil
+	cc.heads = nil
+	return &cc
+}
+
+func (c *lstmController) setGrads(ck Controller) {
+	o := ck.(*lstmController)
+	copy(c.HGrad, o.HGrad)
+	copy(c.CGrad, o.CGrad)
+}
+
+// lstmInference runs a lstmController forward with buffers that are reused across time steps.
+type lstmInference struct {
+	c *lstmController
+	// wh and wy are the weights of c, which are computed once since computing their layout allocates.
+	wh blas64.General
+	wy blas64.General
+
+	readsX []float64 // the reads, x, the hidden state at time t-1 and a bias unit
+	gates  []float64
+	cell   []float64
+	h      []float64
+	out    []float64
+}
+
+func (c *lstmController) inference() controllerInference {
+	ci := lstmInference{
+		c:      c,
+		wh:     c.whVal(),
+		wy:     c.wyVal(),
+		readsX: make([]float64, c.whCols()),
+		gates:  make([]float64, 4*c.hSize),
+		cell:   make([]float64, c.hSize),
+		h:      make([]float64, c.hSize+1),
+		out:    make([]float64, c.wyRows()),
+	}
+	return &ci
+}
+
+func (ci *lstmInference) forward(reads, x []float64) {
+	c := ci.c
+	h := c.hSize
+	copy(ci.readsX, reads)
+	copy(ci.readsX[len(reads):], x)
+	copy(ci.readsX[len(reads)+len(x):], ci.h[0:h])
+	ci.readsX[len(ci.readsX)-1] = 1
+
+	blas64.Gemv(blas.NoTrans, 1, ci.wh, blas64.Vector{Inc: 1, Data: ci.readsX}, 0, blas64.Vector{Inc: 1, Data: ci.gates})
+	for i := 0; i < 3*h; i++ {
+		ci.gates[i] = Sigmoid(ci.gates[i])
+	}
+	for i := 3 * h; i < 4*h; i++ {
+		ci.gates[i] = math.Tanh(ci.gates[i])
+	}
+
+	for i := 0; i < h; i++ {
+		ci.cell[i] = ci.gates[i]*ci.gates[3*h+i] + ci.gates[h+i]*ci.cell[i]
+		ci.h[i] = ci.gates[2*h+i] * math.Tanh(ci.cell[i])
+	}
+
+	ci.h[h] = 1
+	blas64.Gemv(blas.NoTrans, 1, ci.wy, blas64.Vector{Inc: 1, Data: ci.h}, 0, blas64.Vector{Inc: 1, Data: ci.out})
+}
+
+func (ci *lstmInference) output() []float64 {
+	return ci.out
+}
+
+func (ci *lstmInference) reset() {
+	for i := range ci.cell {
+		ci.cell[i] = 0
+		ci.h[i] = 0
+	}
+}
+
+func (ci *lstmInference) states() [][]float64 {
+	return [][]float64{ci.h, ci.cell}
+}
+
+// lstmInference32 is the float32 counterpart of lstmInference.
+type lstmInference32 struct {
+	c  *lstmController
+	wh blas32.General
+	wy blas32.General
+
+	readsX []float32
+	gates  []float32
+	cell   []float32
+	h      []float32
+	out    []float32
+}
+
+func (c *lstmController) inference32(weights []float32) controllerInference32 {
+	ci := lstmInference32{
+		c:      c,
+		wh:     general32(c.whVal(), weights, 0),
+		wy:     general32(c.wyVal(), weights, c.wyOffset()),
+		readsX: make([]float32, c.whCols()),
+		gates:  make([]float32, 4*c.hSize),
+		cell:   make([]float32, c.hSize),
+		h:      make([]float32, c.hSize+1),
+		out:    make([]float32, c.wyRows()),
+	}
+	return &ci
+}
+
+func (ci *lstmInference32) forward(reads, x []float32) {
+	c := ci.c
+	h := c.hSize
+	copy(ci.readsX, reads)
+	copy(ci.readsX[len(reads):], x)
+	copy(ci.readsX[len(reads)+len(x):], ci.h[0:h])
+	ci.readsX[len(ci.readsX)-1] = 1
+
+	blas32.Gemv(blas.NoTrans, 1, ci.wh, blas32.Vector{Inc: 1, Data: ci.readsX}, 0, blas32.Vector{Inc: 1, Data: ci.gates})
+	for i := 0; i < 3*h; i++ {
+		ci.gates[i] = sigmoid32(ci.gates[i])
+	}
+	for i := 3 * h; i < 4*h; i++ {
+		ci.gates[i] = tanh32(ci.gates[i])
+	}
+
+	for i := 0; i < h; i++ {
+		ci.cell[i] = ci.gates[i]*ci.gates[3*h+i] + ci.gates[h+i]*ci.cell[i]
+		ci.h[i] = ci.gates[2*h+i] * tanh32(ci.cell[i])
+	}
+
+	ci.h[h] = 1
+	blas32.Gemv(blas.NoTrans, 1, ci.wy, blas32.Vector{Inc: 1, Data: ci.h}, 0, blas32.Vector{Inc: 1, Data: ci.out})
+}
+
+func (ci *lstmInference32) output() []float32 {
+	return ci.out
+}
+
+func (ci *lstmInference32) reset() {
+	for i := range ci.cell {
+		ci.cell[i] = 0
+		ci.h[i] = 0
+	}
+}
+
+func (c *lstmController) WeightsDesc(i int) string {
+	if i < c.wyOffset() {
+		return fmt.Sprintf("wh[%d][%d]", i/c.whCols(), i%c.whCols())
+	}
+	if i < c.wtm1Offset() {
+		j := i - c.wyOffset()
+		cols := c.hSize + 1
+		return fmt.Sprintf("wy[%d][%d]", j/cols, j%cols)
+	}
+	if i < c.mtm1Offset() {
+		j := i - c.wtm1Offset()
+		return c.mems.wtm1Desc(j)
+	}
+	j := i - c.mtm1Offset()
+	return c.mems.mtm1Desc(j)
+}
+
+func (c *lstmController) NumHeads() int {
+	return c.mems.numWeightings()
+}
+
+func (c *lstmController) Memories() []MemorySpec {
+	return c.mems
+}
+
+func (c *lstmController) spec() ControllerSpec {
+	return ControllerSpec{Type: LSTMType, XSize: c.xSize, YSize: c.ySize, HSize: c.hSize, Memories: append([]MemorySpec(nil), c.mems...)}
+}
+
+func (c *lstmController) MemoryN() int {
+	return c.mems[0].N
+}
+
+func (c *lstmController) MemoryM() int {
+	return c.mems[0].M
+}
@@ -0,0 +1,94 @@
+package ntm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestLSTMController(t *testing.T) {
+	times := 9
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	y := makeTensor2(times, 4)
+	for i := 0; i < len(y); i++ {
+		for j := 0; j < len(y[i]); j++ {
+			y[i][j] = rand.Float64()
+		}
+	}
+	n := 3
+	m := 2
+	hSize := 3
+	numHeads := 2
+	c := NewEmptyLSTMController(len(x[0]), len(y[0]), hSize, numHeads, n, m)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &LogisticModel{Y: y}
+	ForwardBackward(c, x, model)
+	checkRecurrentGradients(t, c, NewLSTMForward, x, model)
+}
+
+// NewLSTMForward returns a ground truth forward pass of a lstmController,
+// which keeps the hidden and cell states of the LSTM layer across time steps.
+func NewLSTMForward() ControllerForward {
+	var hPrev, cPrev []float64
+	return func(c1 Controller, reads [][]float64, x []float64) ([]float64, []*Head) {
+		c := c1.(*lstmController)
+		if hPrev == nil {
+			hPrev = make([]float64, c.hSize)
+			cPrev = make([]float64, c.hSize)
+		}
+		readX := make([]float64, 0)
+		for _, read := range reads {
+			readX = append(readX, read...)
+		}
+		readX = append(readX, x...)
+		readX = append(readX, hPrev...)
+		readX = append(readX, 1)
+
+		gates := make([]float64, 4*c.hSize)
+		wh := c.whVal()
+		for i := range gates {
+			var v float64 = 0
+			for j, rx := range readX {
+				v += wh.Data[i*wh.Cols+j] * rx
+			}
+			gates[i] = v
+		}
+		h := make([]float64, c.hSize)
+		cell := make([]float64, c.hSize)
+		for i := range h {
+			in := Sigmoid(gates[i])
+			f := Sigmoid(gates[c.hSize+i])
+			o := Sigmoid(gates[2*c.hSize+i])
+			g := math.Tanh(gates[3*c.hSize+i])
+			cell[i] = f*cPrev[i] + in*g
+			h[i] = o * math.Tanh(cell[i])
+		}
+		hPrev = h
+		cPrev = cell
+
+		out := make([]float64, c.wyRows())
+		wy := c.wyVal()
+		h = append(h, 1)
+		for i := range out {
+			var v float64 = 0
+			for j, hv := range h {
+				v += wy.Data[i*wy.Cols+j] * hv
+			}
+			out[i] = v
+		}
+		prediction := make([]float64, c.ySize)
+		copy(prediction, out)
+		heads := newControllerHeads(c.mems, out[c.ySize:])
+
+		return prediction, heads
+	}
+}
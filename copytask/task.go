@@ -0,0 +1,55 @@
+package copytask
+
+import (
+	"fmt"
+	"math/rand"
+
+	"ntm"
+	"ntm/task"
+)
+
+func init() {
+	task.Register("copytask", func(string) (task.Task, error) {
+		return &Task{VectorSize: 8, MaxLen: 20}, nil
+	})
+}
+
+// Task is the copy task as a task.Task, in which NTMs are trained on sequences of 1 to MaxLen vectors of VectorSize bits.
+type Task struct {
+	VectorSize int
+	MaxLen     int
+}
+
+func (t *Task) InputSize() int {
+	return t.VectorSize + 2
+}
+
+func (t *Task) OutputSize() int {
+	return t.VectorSize
+}
+
+func (t *Task) Sample() task.Seq {
+	return t.seq(rand.Intn(t.MaxLen) + 1)
+}
+
+func (t *Task) seq(size int) task.Seq {
+	x, y := GenSeq(size, t.VectorSize)
+	return task.Seq{X: x, Y: y, Model: &ntm.LogisticModel{Y: y}}
+}
+
+// Loss returns the loss in nats per bit of the output.
+func (t *Task) Loss(seq task.Seq, predictions [][]float64) float64 {
+	return seq.Model.Loss(predictions) / float64(len(seq.Y)*t.VectorSize)
+}
+
+func (t *Task) Evals() []task.Eval {
+	sizes := []int{10, 20, 30, 50, 120}
+	evals := make([]task.Eval, 0, len(sizes))
+	for _, size := range sizes {
+		evals = append(evals, task.Eval{
+			Name:   fmt.Sprintf("sequence length %d", size),
+			Sample: func() task.Seq { return t.seq(size) },
+		})
+	}
+	return evals
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"html/template"
 	"log"
@@ -13,7 +12,7 @@ import (
 )
 
 var (
-	weightsFile = flag.String("weightsFile", "", "trained weights in JSON")
+	weightsFile = flag.String("weightsFile", "", "a checkpoint or trained weights in JSON")
 )
 
 type Run struct {
@@ -32,8 +31,20 @@ func main() {
 	numHeads := 1
 	n := 128
 	m := 20
-	c := ntm.NewEmptyController1(vectorSize+2, vectorSize, h1Size, numHeads, n, m)
-	copy(c.WeightsVal(), weightsFromFile())
+	spec := ntm.ControllerSpec{Type: ntm.Controller1Type, XSize: vectorSize + 2, YSize: vectorSize, HSize: h1Size, Memories: []ntm.MemorySpec{{N: n, M: m, NumHeads: numHeads}}}
+	if *weightsFile == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	ck, err := ntm.LoadCheckpoint(*weightsFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	// Bare arrays of weights dumped before checkpoints existed are of the controller described by spec.
+	c, err := ck.NewControllerWithDefault(spec)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	seqLens := []int{10, 20, 30, 50, 120}
 	runs := make([]Run, 0, len(seqLens))
@@ -43,7 +54,7 @@ func main() {
 		machines := ntm.ForwardBackward(c, x, model)
 		l := model.Loss(ntm.Predictions(machines))
 		bps := l / float64(len(y)*len(y[0]))
-		log.Printf("sequence length: %d, loss: %f", seql, bps)
+		log.Printf("sequence length: %d, loss: %f, float32 divergence: %g", seql, bps, ntm.Divergence32(c, &ntm.LogisticModel{}, x, ntm.Predictions(machines)))
 
 		r := Run{
 			SeqLen:      seql,
@@ -149,21 +160,3 @@ func root(runs []Run) func(http.ResponseWriter, *http.Request) {
 		rootTmpl.Execute(w, page)
 	}
 }
-
-func weightsFromFile() []float64 {
-	if *weightsFile == "" {
-		flag.PrintDefaults()
-		os.Exit(1)
-	}
-
-	f, err := os.Open(*weightsFile)
-	if err != nil {
-		log.Fatalf("%v", err)
-	}
-	defer f.Close()
-	ws := make([]float64, 0)
-	if err := json.NewDecoder(f).Decode(&ws); err != nil {
-		log.Fatalf("%v", err)
-	}
-	return ws
-}
@@ -0,0 +1,700 @@
+package ntm
+
+import (
+	"math"
+	"sort"
+
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas32"
+	"github.com/gonum/blas/blas64"
+)
+
+// dncOp is the memory circuit of a Differentiable Neural Computer in a single time step, as described in
+// A. Graves et al. Hybrid computing using a neural network with dynamic external memory. Nature 538, 471-476, 2016.
+//
+// Its heads are the read heads followed by a single write head.
+// Unlike memOp, the write head writes before the read heads read, and it chooses between content addressing and
+// dynamically allocating the least used locations. The read heads choose between content addressing and
+// following the temporal links between successively written locations, in the forward or backward direction.
+type dncOp struct {
+	Heads []*Head
+	Prev  *dncOp // the memory circuit at time t-1
+
+	// UsageVal is the degree in which each memory location is used.
+	UsageVal  []float64
+	UsageGrad []float64
+	// PrecedenceVal is the degree in which each memory location was the last one written.
+	PrecedenceVal  []float64
+	PrecedenceGrad []float64
+	// LinkVal is the temporal link matrix in row major order.
+	// LinkVal[i*N+j] is the degree in which location i was written after location j.
+	LinkVal  []float64
+	LinkGrad []float64
+
+	WW *refocus   // the write weighting
+	WR []*refocus // the read weightings
+	R  []*memRead
+	WM *writtenMemory
+
+	free      []float64 // the free gates of the read heads
+	retention []float64 // the degree in which each location is not freed
+	usageHat  []float64 // the usage before the retention is applied
+	order     []int     // the memory locations in ascending order of usage
+	alloc     []float64 // the allocation weighting
+	allocGate float64
+	writeGate float64
+	wc        *contentAddressing // the content weighting of the write head
+
+	rc    []*contentAddressing // the content weightings of the read heads
+	modes [][]float64          // the read modes of the read heads, laid out as |backward|content|forward|
+	fwd   [][]float64          // the forward weightings of the read heads
+	bwd   [][]float64          // the backward weightings of the read heads
+}
+
+// newEmptyDNCOp creates the circuit at time -1, in which the memory is mtm1 and the read weightings are wrs.
+// The usage, precedence, links and write weighting start from 0.
+func newEmptyDNCOp(wrs []*refocus, reads []*memRead, mtm1 *writtenMemory) *dncOp {
+	n := mtm1.N
+	op := dncOp{
+		UsageVal:       make([]float64, n),
+		UsageGrad:      make([]float64, n),
+		PrecedenceVal:  make([]float64, n),
+		PrecedenceGrad: make([]float64, n),
+		LinkVal:        make([]float64, n*n),
+		LinkGrad:       make([]float64, n*n),
+		WW: &refocus{
+			TopVal:  make([]float64, n),
+			TopGrad: make([]float64, n),
+		},
+		WR: wrs,
+		R:  reads,
+		WM: mtm1,
+	}
+	return &op
+}
+
+func newDNCOp(heads []*Head, prev *dncOp) *dncOp {
+	n := prev.WM.N
+	numReads := len(heads) - 1
+	op := dncOp{
+		Heads: heads,
+		Prev:  prev,
+
+		UsageVal:       make([]float64, n),
+		UsageGrad:      make([]float64, n),
+		PrecedenceVal:  make([]float64, n),
+		PrecedenceGrad: make([]float64, n),
+		LinkVal:        make([]float64, n*n),
+		LinkGrad:       make([]float64, n*n),
+		WW: &refocus{
+			TopVal:  make([]float64, n),
+			TopGrad: make([]float64, n),
+		},
+		WR: make([]*refocus, numReads),
+		R:  make([]*memRead, numReads),
+
+		free:      make([]float64, numReads),
+		retention: make([]float64, n),
+		usageHat:  make([]float64, n),
+		alloc:     make([]float64, n),
+		rc:        make([]*contentAddressing, numReads),
+		modes:     makeTensor2(numReads, 3),
+		fwd:       makeTensor2(numReads, n),
+		bwd:       makeTensor2(numReads, n),
+	}
+	op.forwardUsage()
+	op.forwardAllocation()
+	op.forwardWrite()
+	op.forwardLink()
+	op.forwardRead()
+	return &op
+}
+
+func (op *dncOp) readHeads() []*Head {
+	return op.Heads[:len(op.Heads)-1]
+}
+
+func (op *dncOp) writeHead() *Head {
+	return op.Heads[len(op.Heads)-1]
+}
+
+// forwardUsage increases the usage of the locations written at time t-1,
+// and decreases the usage of the locations read at time t-1 according to the free gates.
+func (op *dncOp) forwardUsage() {
+	prev := op.Prev
+	for i, h := range op.readHeads() {
+		op.free[i] = Sigmoid(*h.FreeVal())
+	}
+	for j := range op.UsageVal {
+		var psi float64 = 1
+		for i, f := range op.free {
+			psi *= 1 - f*prev.WR[i].TopVal[j]
+		}
+		op.retention[j] = psi
+		u := prev.UsageVal[j]
+		w := prev.WW.TopVal[j]
+		op.usageHat[j] = u + w - u*w
+		op.UsageVal[j] = op.usageHat[j] * psi
+	}
+}
+
+// forwardAllocation computes the allocation weighting, which favours the least used locations.
+// The sort order of the locations is treated as a constant in the backward pass.
+func (op *dncOp) forwardAllocation() {
+	op.order = make([]int, len(op.UsageVal))
+	for i := range op.order {
+		op.order[i] = i
+	}
+	sort.SliceStable(op.order, func(a, b int) bool {
+		return op.UsageVal[op.order[a]] < op.UsageVal[op.order[b]]
+	})
+	var p float64 = 1
+	for _, j := range op.order {
+		op.alloc[j] = (1 - op.UsageVal[j]) * p
+		p *= op.UsageVal[j]
+	}
+}
+
+func (op *dncOp) forwardWrite() {
+	w := op.writeHead()
+	op.wc = newMemContentAddressing(w, op.Prev.WM)
+	op.allocGate = Sigmoid(*w.AllocGateVal())
+	op.writeGate = Sigmoid(*w.WriteGateVal())
+	for j := range op.WW.TopVal {
+		op.WW.TopVal[j] = op.writeGate * (op.allocGate*op.alloc[j] + (1-op.allocGate)*op.wc.Top[j].Val)
+	}
+	op.WM = newWrittenMemory([]*refocus{op.WW}, []*Head{w}, op.Prev.WM)
+}
+
+// forwardLink records the order in which locations are written in the temporal link matrix.
+func (op *dncOp) forwardLink() {
+	prev := op.Prev
+	n := op.WM.N
+	ww := op.WW.TopVal
+	var sum float64 = 0
+	for i, wi := range ww {
+		sum += wi
+		for j, wj := range ww {
+			if i == j {
+				continue
+			}
+			op.LinkVal[i*n+j] = (1-wi-wj)*prev.LinkVal[i*n+j] + wi*prev.PrecedenceVal[j]
+		}
+	}
+	for j, w := range ww {
+		op.PrecedenceVal[j] = (1-sum)*prev.PrecedenceVal[j] + w
+	}
+}
+
+func (op *dncOp) forwardRead() {
+	n := op.WM.N
+	link := blas64.General{Rows: n, Cols: n, Stride: n, Data: op.LinkVal}
+	for i, h := range op.readHeads() {
+		wtm1 := blas64.Vector{Inc: 1, Data: op.Prev.WR[i].TopVal}
+		blas64.Gemv(blas.NoTrans, 1, link, wtm1, 0, blas64.Vector{Inc: 1, Data: op.fwd[i]})
+		blas64.Gemv(blas.Trans, 1, link, wtm1, 0, blas64.Vector{Inc: 1, Data: op.bwd[i]})
+		op.rc[i] = newMemContentAddressing(h, op.WM)
+
+		modes := op.modes[i]
+		var max float64 = -math.MaxFloat64
+		for _, v := range h.ReadModeVal() {
+			max = math.Max(max, v)
+		}
+		var sum float64 = 0
+		for k, v := range h.ReadModeVal() {
+			modes[k] = math.Exp(v - max)
+			sum += modes[k]
+		}
+		for k := range modes {
+			modes[k] = modes[k] / sum
+		}
+
+		op.WR[i] = &refocus{
+			TopVal:  make([]float64, n),
+			TopGrad: make([]float64, n),
+		}
+		for j := range op.WR[i].TopVal {
+			op.WR[i].TopVal[j] = modes[0]*op.bwd[i][j] + modes[1]*op.rc[i].Top[j].Val + modes[2]*op.fwd[i][j]
+		}
+		op.R[i] = newMemRead(op.WR[i], op.WM, h.KeySize)
+	}
+}
+
+func (op *dncOp) reads() []*memRead {
+	return op.R
+}
+
+// weights returns the read weightings followed by the write weighting.
+func (op *dncOp) weights() []*refocus {
+	return append(append([]*refocus{}, op.WR...), op.WW)
+}
+
+func (op *dncOp) next(heads []*Head) memoryOp {
+	return newDNCOp(heads, op)
+}
+
+func (op *dncOp) truncate() memoryOp {
+	n := op.WM.N
+	t := dncOp{
+		UsageVal:       op.UsageVal,
+		UsageGrad:      make([]float64, n),
+		PrecedenceVal:  op.PrecedenceVal,
+		PrecedenceGrad: make([]float64, n),
+		LinkVal:        op.LinkVal,
+		LinkGrad:       make([]float64, n*n),
+		WW:             detachWeights(op.WW),
+		WR:             make([]*refocus, len(op.WR)),
+		R:              make([]*memRead, len(op.R)),
+		WM:             detachMemory(op.WM),
+	}
+	for i, w := range op.WR {
+		t.WR[i] = detachWeights(w)
+	}
+	for i, r := range op.R {
+		t.R[i] = detachRead(r)
+	}
+	return &t
+}
+
+func (op *dncOp) checkpoint() memoryOp {
+	return op.truncate()
+}
+
+func (op *dncOp) setGrads(ck memoryOp) {
+	o := ck.(*dncOp)
+	copy(op.UsageGrad, o.UsageGrad)
+	copy(op.PrecedenceGrad, o.PrecedenceGrad)
+	copy(op.LinkGrad, o.LinkGrad)
+	copy(op.WW.TopGrad, o.WW.TopGrad)
+	for i, w := range o.WR {
+		copy(op.WR[i].TopGrad, w.TopGrad)
+	}
+	for i, r := range o.R {
+		copy(op.R[i].TopGrad, r.TopGrad)
+	}
+	copy(op.WM.TopGrad, o.WM.TopGrad)
+}
+
+// Backward performs a backward pass.
+// It assumes that the gradients on the reads, the read and write weightings, the memory, usage, precedence and links
+// have been propagated from the circuit at time t+1.
+func (op *dncOp) Backward() {
+	for _, r := range op.R {
+		r.Backward()
+	}
+	op.backwardRead()
+	op.backwardLink()
+	op.WM.Backward()
+	op.backwardWrite()
+	op.backwardAllocation()
+	op.backwardUsage()
+}
+
+func (op *dncOp) backwardRead() {
+	n := op.WM.N
+	link := blas64.General{Rows: n, Cols: n, Stride: n, Data: op.LinkVal}
+	linkGrad := blas64.General{Rows: n, Cols: n, Stride: n, Data: op.LinkGrad}
+	for i, h := range op.readHeads() {
+		modes := op.modes[i]
+		rc := op.rc[i]
+		grad := op.WR[i].TopGrad
+		var modesGrad [3]float64
+		for j, g := range grad {
+			modesGrad[0] += g * op.bwd[i][j]
+			modesGrad[1] += g * rc.Top[j].Val
+			modesGrad[2] += g * op.fwd[i][j]
+			rc.Top[j].Grad += g * modes[1]
+		}
+		var gm float64 = 0
+		for k, m := range modes {
+			gm += modesGrad[k] * m
+		}
+		hModes := h.ReadModeGrad()
+		for k, m := range modes {
+			hModes[k] += (modesGrad[k] - gm) * m
+		}
+		backwardMemContentAddressing(rc)
+
+		g := blas64.Vector{Inc: 1, Data: grad}
+		wtm1Val := blas64.Vector{Inc: 1, Data: op.Prev.WR[i].TopVal}
+		wtm1Grad := blas64.Vector{Inc: 1, Data: op.Prev.WR[i].TopGrad}
+		// The forward weighting is link * wtm1.
+		blas64.Ger(modes[2], g, wtm1Val, linkGrad)
+		blas64.Gemv(blas.Trans, modes[2], link, g, 1, wtm1Grad)
+		// The backward weighting is link^T * wtm1.
+		blas64.Ger(modes[0], wtm1Val, g, linkGrad)
+		blas64.Gemv(blas.NoTrans, modes[0], link, g, 1, wtm1Grad)
+	}
+}
+
+func (op *dncOp) backwardLink() {
+	prev := op.Prev
+	n := op.WM.N
+	ww := op.WW.TopVal
+	wwGrad := op.WW.TopGrad
+	for i, wi := range ww {
+		for j, wj := range ww {
+			if i == j {
+				continue
+			}
+			g := op.LinkGrad[i*n+j]
+			l := prev.LinkVal[i*n+j]
+			prev.LinkGrad[i*n+j] += (1 - wi - wj) * g
+			wwGrad[i] += g * (prev.PrecedenceVal[j] - l)
+			wwGrad[j] -= g * l
+			prev.PrecedenceGrad[j] += g * wi
+		}
+	}
+
+	var sum float64 = 0
+	for _, w := range ww {
+		sum += w
+	}
+	var gp float64 = 0
+	for j, g := range op.PrecedenceGrad {
+		prev.PrecedenceGrad[j] += (1 - sum) * g
+		gp += g * prev.PrecedenceVal[j]
+	}
+	for j, g := range op.PrecedenceGrad {
+		wwGrad[j] += g - gp
+	}
+}
+
+func (op *dncOp) backwardWrite() {
+	w := op.writeHead()
+	ga := op.allocGate
+	gw := op.writeGate
+	var gaGrad float64 = 0
+	var gwGrad float64 = 0
+	for j, g := range op.WW.TopGrad {
+		a := op.alloc[j]
+		c := op.wc.Top[j].Val
+		gwGrad += g * (ga*a + (1-ga)*c)
+		gaGrad += g * gw * (a - c)
+		op.wc.Top[j].Grad += g * gw * (1 - ga)
+	}
+	*w.WriteGateGrad() += gwGrad * gw * (1 - gw)
+	*w.AllocGateGrad() += gaGrad * ga * (1 - ga)
+	backwardMemContentAddressing(op.wc)
+}
+
+// backwardAllocation propagates the gradients of the allocation weighting to the usage.
+// Denote the sorted usage as u[0], u[1], ..., then alloc[k] = (1 - u[k]) * u[0] * ... * u[k-1], and
+// the gradient on u[l] is u[0] * ... * u[l-1] * (T[l] - allocGrad[l]), where T[l] is accumulated backwards as
+// T[l-1] = allocGrad[l] * (1 - u[l]) + u[l] * T[l], without dividing by possibly zero usages.
+func (op *dncOp) backwardAllocation() {
+	scale := op.writeGate * op.allocGate
+	prods := make([]float64, len(op.order))
+	var p float64 = 1
+	for k, j := range op.order {
+		prods[k] = p
+		p *= op.UsageVal[j]
+	}
+	var tl float64 = 0
+	for k := len(op.order) - 1; k >= 0; k-- {
+		j := op.order[k]
+		ag := op.WW.TopGrad[j] * scale
+		op.UsageGrad[j] += prods[k] * (tl - ag)
+		tl = ag*(1-op.UsageVal[j]) + op.UsageVal[j]*tl
+	}
+}
+
+func (op *dncOp) backwardUsage() {
+	prev := op.Prev
+	freeGrad := make([]float64, len(op.free))
+	for j, g := range op.UsageGrad {
+		hatGrad := g * op.retention[j]
+		psiGrad := g * op.usageHat[j]
+		u := prev.UsageVal[j]
+		w := prev.WW.TopVal[j]
+		prev.UsageGrad[j] += hatGrad * (1 - w)
+		prev.WW.TopGrad[j] += hatGrad * (1 - u)
+
+		for i, f := range op.free {
+			var others float64 = 1
+			for k, fk := range op.free {
+				if k != i {
+					others *= 1 - fk*prev.WR[k].TopVal[j]
+				}
+			}
+			freeGrad[i] -= psiGrad * others * prev.WR[i].TopVal[j]
+			prev.WR[i].TopGrad[j] -= psiGrad * others * f
+		}
+	}
+	for i, h := range op.readHeads() {
+		f := op.free[i]
+		*h.FreeGrad() += freeGrad[i] * f * (1 - f)
+	}
+}
+
+// dncInference runs a dncOp forward, as in Inference.
+type dncInference struct {
+	spec MemorySpec
+	mem  []float64
+
+	usage      []float64
+	precedence []float64
+	link       []float64
+	ww         [][]float64 // the write weighting, which is the only weighting of the single writer
+	wr         [][]float64 // the read weightings at time t-1, which are overwritten by those at time t
+
+	free  []float64
+	alloc []float64
+	order *usageOrder
+	wc    []float64
+	modes []float64
+	fwd   []float64
+	bwd   []float64
+	erase [][]float64
+	add   [][]float64
+}
+
+func newDNCInference(mem MemorySpec) *dncInference {
+	n := mem.N
+	di := dncInference{
+		spec:       mem,
+		mem:        make([]float64, n*mem.M),
+		usage:      make([]float64, n),
+		precedence: make([]float64, n),
+		link:       make([]float64, n*n),
+		ww:         makeTensor2(1, n),
+		wr:         makeTensor2(mem.NumHeads, n),
+		free:       make([]float64, mem.NumHeads),
+		alloc:      make([]float64, n),
+		wc:         make([]float64, n),
+		modes:      make([]float64, 3),
+		fwd:        make([]float64, n),
+		bwd:        make([]float64, n),
+		erase:      makeTensor2(1, mem.M),
+		add:        makeTensor2(1, mem.M),
+	}
+	di.order = newUsageOrder(di.usage)
+	return &di
+}
+
+func (di *dncInference) reset(wtm1, mtm1, reads []float64) {
+	n := di.spec.N
+	rs := di.spec.readSize()
+	copy(di.mem, mtm1)
+	for j := range di.usage {
+		di.usage[j] = 0
+		di.precedence[j] = 0
+		di.ww[0][j] = 0
+	}
+	for j := range di.link {
+		di.link[j] = 0
+	}
+	for i, w := range di.wr {
+		copy(w, wtm1[i*n:(i+1)*n])
+		softmax(w)
+		readMemory(w, di.mem, di.spec.M, di.spec.KeySize, reads[i*rs:(i+1)*rs])
+	}
+}
+
+func (di *dncInference) states() [][]float64 {
+	s := [][]float64{di.mem, di.usage, di.precedence, di.link}
+	s = append(s, di.ww...)
+	return append(s, di.wr...)
+}
+
+// step runs the same steps as newDNCOp, in which the states at time t-1 are overwritten in place.
+func (di *dncInference) step(heads []*Head, reads []float64) {
+	n := di.spec.N
+	rs := di.spec.readSize()
+	readHeads := heads[:len(heads)-1]
+	w := heads[len(heads)-1]
+	ww := di.ww[0]
+
+	// Usage.
+	for i, h := range readHeads {
+		di.free[i] = Sigmoid(*h.FreeVal())
+	}
+	for j, u := range di.usage {
+		var psi float64 = 1
+		for i, f := range di.free {
+			psi *= 1 - f*di.wr[i][j]
+		}
+		di.usage[j] = (u + ww[j] - u*ww[j]) * psi
+	}
+
+	// Allocation.
+	var p float64 = 1
+	for _, j := range di.order.sort() {
+		di.alloc[j] = (1 - di.usage[j]) * p
+		p *= di.usage[j]
+	}
+
+	// Write.
+	contentWeights(w, di.mem, di.wc)
+	allocGate := Sigmoid(*w.AllocGateVal())
+	writeGate := Sigmoid(*w.WriteGateVal())
+	for j := range ww {
+		ww[j] = writeGate * (allocGate*di.alloc[j] + (1-allocGate)*di.wc[j])
+	}
+	addVec := w.AddVal()
+	for j, e := range w.EraseVal() {
+		di.erase[0][j] = Sigmoid(e)
+		di.add[0][j] = Sigmoid(addVec[j])
+	}
+	writeMemory(di.mem, di.spec.M, di.ww, di.erase, di.add)
+
+	// Temporal links.
+	var sum float64 = 0
+	for i, wi := range ww {
+		sum += wi
+		for j, wj := range ww {
+			if i == j {
+				continue
+			}
+			di.link[i*n+j] = (1-wi-wj)*di.link[i*n+j] + wi*di.precedence[j]
+		}
+	}
+	for j, v := range ww {
+		di.precedence[j] = (1-sum)*di.precedence[j] + v
+	}
+
+	// Read.
+	link := blas64.General{Rows: n, Cols: n, Stride: n, Data: di.link}
+	for i, h := range readHeads {
+		wr := di.wr[i]
+		blas64.Gemv(blas.NoTrans, 1, link, blas64.Vector{Inc: 1, Data: wr}, 0, blas64.Vector{Inc: 1, Data: di.fwd})
+		blas64.Gemv(blas.Trans, 1, link, blas64.Vector{Inc: 1, Data: wr}, 0, blas64.Vector{Inc: 1, Data: di.bwd})
+		contentWeights(h, di.mem, di.wc)
+		copy(di.modes, h.ReadModeVal())
+		softmax(di.modes)
+		for j := range wr {
+			wr[j] = di.modes[0]*di.bwd[j] + di.modes[1]*di.wc[j] + di.modes[2]*di.fwd[j]
+		}
+		readMemory(wr, di.mem, di.spec.M, di.spec.KeySize, reads[i*rs:(i+1)*rs])
+	}
+}
+
+// dncInference32 is the float32 counterpart of dncInference.
+type dncInference32 struct {
+	spec MemorySpec
+	mem  []float32
+
+	usage      []float32
+	precedence []float32
+	link       []float32
+	ww         [][]float32
+	wr         [][]float32
+
+	free  []float32
+	alloc []float32
+	order *usageOrder32
+	wc    []float32
+	modes []float32
+	fwd   []float32
+	bwd   []float32
+	erase [][]float32
+	add   [][]float32
+}
+
+func newDNCInference32(mem MemorySpec) *dncInference32 {
+	n := mem.N
+	di := dncInference32{
+		spec:       mem,
+		mem:        make([]float32, n*mem.M),
+		usage:      make([]float32, n),
+		precedence: make([]float32, n),
+		link:       make([]float32, n*n),
+		ww:         makeTensor2Float32(1, n),
+		wr:         makeTensor2Float32(mem.NumHeads, n),
+		free:       make([]float32, mem.NumHeads),
+		alloc:      make([]float32, n),
+		wc:         make([]float32, n),
+		modes:      make([]float32, 3),
+		fwd:        make([]float32, n),
+		bwd:        make([]float32, n),
+		erase:      makeTensor2Float32(1, mem.M),
+		add:        makeTensor2Float32(1, mem.M),
+	}
+	di.order = newUsageOrder32(di.usage)
+	return &di
+}
+
+func (di *dncInference32) reset(wtm1, mtm1, reads []float32) {
+	n := di.spec.N
+	rs := di.spec.readSize()
+	copy(di.mem, mtm1)
+	for j := range di.usage {
+		di.usage[j] = 0
+		di.precedence[j] = 0
+		di.ww[0][j] = 0
+	}
+	for j := range di.link {
+		di.link[j] = 0
+	}
+	for i, w := range di.wr {
+		copy(w, wtm1[i*n:(i+1)*n])
+		softmax32(w)
+		readMemory32(w, di.mem, di.spec.M, di.spec.KeySize, reads[i*rs:(i+1)*rs])
+	}
+}
+
+func (di *dncInference32) step(heads []*head32, reads []float32) {
+	n := di.spec.N
+	rs := di.spec.readSize()
+	readHeads := heads[:len(heads)-1]
+	w := heads[len(heads)-1]
+	ww := di.ww[0]
+
+	for i, h := range readHeads {
+		di.free[i] = sigmoid32(h.free())
+	}
+	for j, u := range di.usage {
+		var psi float32 = 1
+		for i, f := range di.free {
+			psi *= 1 - f*di.wr[i][j]
+		}
+		di.usage[j] = (u + ww[j] - u*ww[j]) * psi
+	}
+
+	var p float32 = 1
+	for _, j := range di.order.sort() {
+		di.alloc[j] = (1 - di.usage[j]) * p
+		p *= di.usage[j]
+	}
+
+	contentWeights32(w, di.mem, di.wc)
+	allocGate := sigmoid32(w.allocGate())
+	writeGate := sigmoid32(w.writeGate())
+	for j := range ww {
+		ww[j] = writeGate * (allocGate*di.alloc[j] + (1-allocGate)*di.wc[j])
+	}
+	addVec := w.add()
+	for j, e := range w.erase() {
+		di.erase[0][j] = sigmoid32(e)
+		di.add[0][j] = sigmoid32(addVec[j])
+	}
+	writeMemory32(di.mem, di.spec.M, di.ww, di.erase, di.add)
+
+	var sum float32 = 0
+	for i, wi := range ww {
+		sum += wi
+		for j, wj := range ww {
+			if i == j {
+				continue
+			}
+			di.link[i*n+j] = (1-wi-wj)*di.link[i*n+j] + wi*di.precedence[j]
+		}
+	}
+	for j, v := range ww {
+		di.precedence[j] = (1-sum)*di.precedence[j] + v
+	}
+
+	link := blas32.General{Rows: n, Cols: n, Stride: n, Data: di.link}
+	for i, h := range readHeads {
+		wr := di.wr[i]
+		blas32.Gemv(blas.NoTrans, 1, link, blas32.Vector{Inc: 1, Data: wr}, 0, blas32.Vector{Inc: 1, Data: di.fwd})
+		blas32.Gemv(blas.Trans, 1, link, blas32.Vector{Inc: 1, Data: wr}, 0, blas32.Vector{Inc: 1, Data: di.bwd})
+		contentWeights32(h, di.mem, di.wc)
+		copy(di.modes, h.readModes())
+		softmax32(di.modes)
+		for j := range wr {
+			wr[j] = di.modes[0]*di.bwd[j] + di.modes[1]*di.wc[j] + di.modes[2]*di.fwd[j]
+		}
+		readMemory32(wr, di.mem, di.spec.M, di.spec.KeySize, reads[i*rs:(i+1)*rs])
+	}
+}
@@ -0,0 +1,106 @@
+package ntm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDNC(t *testing.T) {
+	times := 9
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	y := makeTensor2(times, 4)
+	for i := 0; i < len(y); i++ {
+		for j := 0; j < len(y[i]); j++ {
+			y[i][j] = rand.Float64()
+		}
+	}
+	h1Size := 3
+	mem := MemorySpec{N: 4, M: 3, NumHeads: 2, DNC: true}
+	c := NewEmptyController1WithMemory(len(x[0]), len(y[0]), h1Size, mem)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &LogisticModel{Y: y}
+	machines := ForwardBackward(c, x, model)
+	if hws := HeadWeights(machines); len(hws) != mem.NumHeads+1 {
+		t.Errorf("got weights of %d heads, expected %d", len(hws), mem.NumHeads+1)
+	}
+	checkForwardBackwardGradients(t, c, x, model)
+}
+
+func TestDNCLSTMController(t *testing.T) {
+	times := 7
+	x := makeTensor2(times, 3)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	outputSize := 3
+	y := make([]int, times)
+	for i := range y {
+		y[i] = rand.Intn(outputSize)
+	}
+	mem := MemorySpec{N: 5, M: 2, NumHeads: 1, DNC: true}
+	c := NewEmptyLSTMControllerWithMemory(len(x[0]), outputSize, 3, mem)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &MultinomialModel{Y: y}
+	ForwardBackward(c, x, model)
+	checkForwardBackwardGradients(t, c, x, model)
+}
+
+func TestDNCAllocation(t *testing.T) {
+	op := dncOp{
+		UsageVal: []float64{0.4, 1, 0.2, 0.5},
+		alloc:    make([]float64, 4),
+	}
+	op.forwardAllocation()
+	expected := []float64{0.6 * 0.2, 0, 0.8, 0.5 * 0.2 * 0.4}
+	for i, a := range op.alloc {
+		if math.Abs(a-expected[i]) > 1e-12 {
+			t.Errorf("allocation[%d] = %f, expected %f", i, a, expected[i])
+		}
+	}
+}
+
+// checkForwardBackwardGradients checks the gradients computed by ForwardBackward against the finite differences of
+// the loss, where the loss is computed by the forward pass of ForwardBackward.
+// It is used for memories that have no ground truth implementation in the tests.
+func checkForwardBackwardGradients(t *testing.T, c Controller, in [][]float64, model DensityModel) {
+	wGrads := make([]float64, len(c.WeightsGrad()))
+	copy(wGrads, c.WeightsGrad())
+	lossOf := func() float64 {
+		return model.Loss(Predictions(ForwardBackward(c, in, model)))
+	}
+	lx := lossOf()
+
+	for i, x := range c.WeightsVal() {
+		h := machineEpsilonSqrt * math.Max(math.Abs(x), 1)
+		xph := x + h
+		c.WeightsVal()[i] = xph
+		lxph := lossOf()
+		c.WeightsVal()[i] = x
+		grad := (lxph - lx) / (xph - x)
+
+		wGrad := wGrads[i]
+		tag := c.WeightsDesc(i)
+		if math.IsNaN(grad) || math.Abs(grad-wGrad) > 1e-5 {
+			t.Errorf("wrong %s gradient expected %f, got %f", tag, grad, wGrad)
+		} else {
+			t.Logf("OK %s gradient expected %f, got %f", tag, grad, wGrad)
+		}
+	}
+	copy(c.WeightsGrad(), wGrads)
+}
@@ -0,0 +1,397 @@
+package ntm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas64"
+)
+
+// An Inference runs a NTM forward one time step at a time without computing gradients, in which all its buffers are
+// allocated once in NewInference and reused across time steps.
+// Hence a time step does not allocate, which is useful for serving a trained model.
+//
+// Since the states of the latest time step are overwritten in place, the output returned by Step is valid only
+// until the next call to Step or Reset. The weights of C are shared, so that updates to them take effect at the
+// next time step, except for the biases of the initial weights and memory, which take effect at the next Reset.
+type Inference struct {
+	C     Controller
+	Model DensityModel
+
+	cntl  controllerInference
+	ySize int
+	heads []*Head
+	banks []memoryInference
+	mems  memories
+	reads []float64 // the vectors read from all banks, which are inputs to the controller at the next time step
+
+	numHeads []int // the number of heads of each bank
+}
+
+// NewInference creates an Inference of the controller c, whose outputs are transformed by model.
+// The ground truth of model is not used.
+// c must be one of the controllers of this package, which implement inference.
+func NewInference(c Controller, model DensityModel) *Inference {
+	ci, ok := c.(inferrer)
+	if !ok {
+		panic(fmt.Sprintf("controller %T does not support inference", c))
+	}
+	inf := Inference{
+		C:     c,
+		Model: model,
+		cntl:  ci.inference(),
+		banks: make([]memoryInference, len(controllerMemories(c))),
+		mems:  controllerMemories(c),
+	}
+	out := inf.cntl.output()
+	inf.ySize = len(out) - inf.mems.numHeadUnits()
+	inf.heads = inf.mems.newHeads(out[inf.ySize:], nil)
+	inf.reads = make([]float64, inf.mems.numReadUnits())
+	inf.numHeads = make([]int, len(inf.mems))
+	for b, mem := range inf.mems {
+		inf.banks[b] = newMemoryInference(mem)
+		inf.numHeads[b] = len(mem.emptyHeads())
+	}
+	inf.Reset()
+	return &inf
+}
+
+// Step feeds x to the NTM, and returns its output after being transformed by the DensityModel.
+func (inf *Inference) Step(x []float64) []float64 {
+	inf.cntl.forward(inf.reads, x)
+	heads := inf.heads
+	reads := inf.reads
+	for b, mem := range inf.mems {
+		nr := mem.numReads() * mem.readSize()
+		inf.banks[b].step(heads[:inf.numHeads[b]], reads[:nr])
+		heads = heads[inf.numHeads[b]:]
+		reads = reads[nr:]
+	}
+	y := inf.cntl.output()[:inf.ySize]
+	inf.Model.Transform(y)
+	return y
+}
+
+// Reset resets the memory, head weights and reads of the NTM to their bias values, as in MakeEmptyNTM,
+// and the states of the controller to 0.
+func (inf *Inference) Reset() {
+	inf.cntl.reset()
+	wtm1 := inf.C.Wtm1BiasVal()
+	mtm1 := inf.C.Mtm1BiasVal()
+	reads := inf.reads
+	for b, mem := range inf.mems {
+		nw := mem.numWeightings() * mem.N
+		nm := mem.N * mem.M
+		nr := mem.numReads() * mem.readSize()
+		inf.banks[b].reset(wtm1[:nw], mtm1[:nm], reads[:nr])
+		wtm1 = wtm1[nw:]
+		mtm1 = mtm1[nm:]
+		reads = reads[nr:]
+	}
+}
+
+// states returns the buffers of the states carried across time steps, which are the reads and the states of the
+// controller and memory banks.
+func (inf *Inference) states() [][]float64 {
+	s := append([][]float64{inf.reads}, inf.cntl.states()...)
+	for _, b := range inf.banks {
+		s = append(s, b.states()...)
+	}
+	return s
+}
+
+// An inferrer is a Controller that can be run forward without gradients, as in Inference.
+type inferrer interface {
+	// inference returns a controllerInference which runs this Controller forward, as in Inference.
+	inference() controllerInference
+}
+
+// A controllerInference runs a Controller forward without gradients, with buffers that are reused across time steps.
+type controllerInference interface {
+	// forward computes the output of the controller from the concatenated reads and the input x.
+	forward(reads, x []float64)
+	// output returns the buffer of the output of the controller, which is laid out as |y|units of heads|.
+	output() []float64
+	// reset sets the states carried across time steps to 0.
+	reset()
+	// states returns the buffers of the states carried across time steps.
+	states() [][]float64
+}
+
+// A memoryInference runs the circuits of a memory bank forward, with buffers that are reused across time steps.
+type memoryInference interface {
+	// step operates on the memory as directed by heads, and stores the concatenated vectors read into reads.
+	step(heads []*Head, reads []float64)
+	// reset sets the head weights and memory to their biases wtm1 and mtm1, and stores the initial reads into reads.
+	reset(wtm1, mtm1, reads []float64)
+	// states returns the buffers of the states carried across time steps, such as the memory and head weights.
+	states() [][]float64
+}
+
+func newMemoryInference(mem MemorySpec) memoryInference {
+	if mem.DNC {
+		return newDNCInference(mem)
+	}
+	if mem.SparseK > 0 {
+		return newSparseInference(mem)
+	}
+	return newMemOpInference(mem)
+}
+
+// memOpInference runs a memOp forward, including least recently used access.
+type memOpInference struct {
+	spec MemorySpec
+	mem  []float64
+	w    [][]float64 // the weights of each head at time t-1, which are overwritten by those at time t
+
+	wc    []float64 // the content weights
+	wg    []float64 // the gated weights
+	sw    []float64 // the shifted weights
+	shift []float64
+
+	ws    [][]float64 // the write weights of the heads that write at time t
+	lw    [][]float64 // the write weights in least recently used access
+	erase [][]float64
+	add   [][]float64
+
+	usage     []float64
+	leastUsed []float64
+	order     *usageOrder
+}
+
+func newMemOpInference(mem MemorySpec) *memOpInference {
+	numHeads := mem.numWeightings()
+	mi := memOpInference{
+		spec:  mem,
+		mem:   make([]float64, mem.N*mem.M),
+		w:     makeTensor2(numHeads, mem.N),
+		wc:    make([]float64, mem.N),
+		wg:    make([]float64, mem.N),
+		sw:    make([]float64, mem.N),
+		shift: make([]float64, mem.ShiftWidth),
+		ws:    make([][]float64, 0, numHeads),
+		lw:    makeTensor2(numHeads, mem.N),
+		erase: makeTensor2(numHeads, mem.M),
+		add:   makeTensor2(numHeads, mem.M),
+	}
+	if mem.LRUA {
+		mi.usage = make([]float64, mem.N)
+		mi.leastUsed = make([]float64, mem.N)
+		mi.order = newUsageOrder(mi.usage)
+	}
+	return &mi
+}
+
+func (mi *memOpInference) reset(wtm1, mtm1, reads []float64) {
+	copy(mi.mem, mtm1)
+	for i, w := range mi.w {
+		copy(w, wtm1[i*mi.spec.N:(i+1)*mi.spec.N])
+		softmax(w)
+	}
+	rs := mi.spec.readSize()
+	for i := 0; i < mi.spec.numReads(); i++ {
+		readMemory(mi.w[i], mi.mem, mi.spec.M, mi.spec.KeySize, reads[i*rs:(i+1)*rs])
+	}
+	if mi.usage != nil {
+		for i := range mi.usage {
+			mi.usage[i] = 0
+		}
+		mi.order.leastUsed(mi.leastUsed, len(mi.w))
+	}
+}
+
+func (mi *memOpInference) states() [][]float64 {
+	s := append([][]float64{mi.mem}, mi.w...)
+	if mi.usage != nil {
+		s = append(s, mi.usage, mi.leastUsed)
+	}
+	return s
+}
+
+func (mi *memOpInference) step(heads []*Head, reads []float64) {
+	n := mi.spec.N
+	rs := mi.spec.readSize()
+	mi.ws = mi.ws[:0]
+	for i, h := range heads {
+		wtm1 := mi.w[i]
+		contentWeights(h, mi.mem, mi.wc)
+		g := Sigmoid(*h.GVal())
+		for j := range mi.wg {
+			mi.wg[j] = g*mi.wc[j] + (1-g)*wtm1[j]
+		}
+		if h.ShiftWidth > 0 {
+			copy(mi.shift, h.ShiftVal())
+			softmax(mi.shift)
+			for j := range mi.sw {
+				mi.sw[j] = 0
+				for k, s := range mi.shift {
+					offset := k - len(mi.shift)/2
+					mi.sw[j] += mi.wg[((j-offset)%n+n)%n] * s
+				}
+			}
+		} else {
+			z := math.Mod(2*Sigmoid(*h.SVal())-1+float64(n), float64(n))
+			simj := 1 - (z - math.Floor(z))
+			for j := range mi.sw {
+				imj := (j + int(z)) % n
+				mi.sw[j] = mi.wg[imj]*simj + mi.wg[(imj+1)%n]*(1-simj)
+			}
+		}
+
+		if h.writes() {
+			k := len(mi.ws)
+			if h.kind == lruaHead {
+				alpha := Sigmoid(*h.AlphaVal())
+				for j, lu := range mi.leastUsed {
+					mi.lw[k][j] = alpha*wtm1[j] + (1-alpha)*lu
+				}
+				mi.ws = append(mi.ws, mi.lw[k])
+			} else {
+				mi.ws = append(mi.ws, wtm1)
+			}
+			addVec := h.AddVal()
+			for j, e := range h.EraseVal() {
+				mi.erase[k][j] = Sigmoid(e)
+				mi.add[k][j] = Sigmoid(addVec[j])
+			}
+		}
+
+		// The weights at time t-1 are no longer needed, and are overwritten by those at time t.
+		gamma := math.Log(math.Exp(*h.GammaVal())+1) + 1
+		var sum float64 = 0
+		for j, v := range mi.sw {
+			wtm1[j] = math.Pow(v, gamma)
+			sum += wtm1[j]
+		}
+		for j := range wtm1 {
+			wtm1[j] = wtm1[j] / sum
+		}
+		if h.reads() {
+			readMemory(wtm1, mi.mem, mi.spec.M, mi.spec.KeySize, reads[:rs])
+			reads = reads[rs:]
+		}
+	}
+	writeMemory(mi.mem, mi.spec.M, mi.ws, mi.erase, mi.add)
+
+	if mi.usage == nil {
+		return
+	}
+	for j, u := range mi.usage {
+		mi.usage[j] = mi.spec.UsageDecay * u
+		for i, h := range heads {
+			if h.reads() {
+				mi.usage[j] += mi.w[i][j]
+			}
+		}
+		for _, w := range mi.ws {
+			mi.usage[j] += w[j]
+		}
+	}
+	mi.order.leastUsed(mi.leastUsed, len(mi.w))
+}
+
+// contentWeights computes the content weights of the head h over the memory vectors in mem into w.
+func contentWeights(h *Head, mem []float64, w []float64) {
+	b := math.Exp(*h.BetaVal())
+	k := h.KVal()
+	for i := range w {
+		w[i] = b * circuitSimilarity(h.Similarity, k, mem[i*h.M:i*h.M+h.keyLen()])
+	}
+	softmax(w)
+}
+
+// circuitSimilarity computes the similarity between u and v in the same way as the circuits of newSimilarityCircuit,
+// so that the weights of an Inference are identical to those of the machines created by NewNTM.
+// Otherwise, rounding errors might break ties differently, such as ties in the usage of DNC memory locations.
+func circuitSimilarity(kind Similarity, u, v []float64) float64 {
+	uv := blas64.Dot(len(u), blas64.Vector{Inc: 1, Data: u}, blas64.Vector{Inc: 1, Data: v})
+	switch kind {
+	case DotSimilarity:
+		return uv
+	case EuclideanSimilarity:
+		var sum float64 = 0
+		for i, ui := range u {
+			d := ui - v[i]
+			sum += d * d
+		}
+		return -math.Sqrt(sum)
+	}
+	unorm := blas64.Nrm2(len(u), blas64.Vector{Inc: 1, Data: u})
+	vnorm := blas64.Nrm2(len(v), blas64.Vector{Inc: 1, Data: v})
+	return uv / (unorm * vnorm)
+}
+
+// softmax normalizes x into a softmax distribution in place.
+func softmax(x []float64) {
+	var max float64 = -math.MaxFloat64
+	for _, v := range x {
+		max = math.Max(max, v)
+	}
+	var sum float64 = 0
+	for i, v := range x {
+		x[i] = math.Exp(v - max)
+		sum += x[i]
+	}
+	for i, v := range x {
+		x[i] = v / sum
+	}
+}
+
+// readMemory reads the memory vectors in mem, starting at offset, with the weights w into r.
+func readMemory(w, mem []float64, m, offset int, r []float64) {
+	memory := blas64.General{Rows: len(w), Cols: m - offset, Stride: m, Data: mem[offset:]}
+	blas64.Gemv(blas.Trans, 1, memory, blas64.Vector{Inc: 1, Data: w}, 0, blas64.Vector{Inc: 1, Data: r})
+}
+
+// writeMemory erases and adds to mem with the weights ws of each head that writes, as in newWrittenMemory.
+func writeMemory(mem []float64, m int, ws, erase, add [][]float64) {
+	for i := range mem {
+		j, c := i/m, i%m
+		v := mem[i]
+		for k, w := range ws {
+			v *= 1 - w[j]*erase[k][c]
+		}
+		for k, w := range ws {
+			v += w[j] * add[k][c]
+		}
+		mem[i] = v
+	}
+}
+
+// usageOrder sorts memory locations in ascending order of their usage without allocating.
+type usageOrder struct {
+	usage []float64
+	order []int
+}
+
+func newUsageOrder(usage []float64) *usageOrder {
+	return &usageOrder{usage: usage, order: make([]int, len(usage))}
+}
+
+func (o *usageOrder) Len() int           { return len(o.order) }
+func (o *usageOrder) Less(a, b int) bool { return o.usage[o.order[a]] < o.usage[o.order[b]] }
+func (o *usageOrder) Swap(a, b int)      { o.order[a], o.order[b] = o.order[b], o.order[a] }
+
+// sort sorts the locations, where ties are broken by position, and returns them.
+func (o *usageOrder) sort() []int {
+	for i := range o.order {
+		o.order[i] = i
+	}
+	sort.Stable(o)
+	return o.order
+}
+
+// leastUsed stores into lu an indicator of the n least used locations, as in the function leastUsed.
+func (o *usageOrder) leastUsed(lu []float64, n int) {
+	for i := range lu {
+		lu[i] = 0
+	}
+	if n > len(lu) {
+		n = len(lu)
+	}
+	for _, i := range o.sort()[:n] {
+		lu[i] = 1
+	}
+}
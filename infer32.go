@@ -0,0 +1,511 @@
+package ntm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gonum/blas"
+	"github.com/gonum/blas/blas32"
+	"github.com/gonum/blas/blas64"
+)
+
+// An Inference32 is like an Inference, except that the controller, the addressing circuits and the memory
+// compute in float32 instead of float64, which halves the memory needed by the weights and the memory banks.
+// The weights of C are converted to float32 in NewInference32, and can be converted again with LoadWeights after
+// they are updated. The inputs and outputs of Step are still float64 for convenience.
+type Inference32 struct {
+	C     Controller
+	Model DensityModel
+
+	weights []float32
+	cntl    controllerInference32
+	ySize   int
+	heads   []*head32
+	banks   []memoryInference32
+	mems    memories
+	reads   []float32
+	x       []float32
+	y       []float64
+
+	numHeads []int // the number of heads of each bank
+}
+
+// NewInference32 creates an Inference32 of the controller c, whose outputs are transformed by model.
+// The ground truth of model is not used.
+// c must be one of the controllers of this package, which implement inference.
+func NewInference32(c Controller, model DensityModel) *Inference32 {
+	ci, ok := c.(inferrer32)
+	if !ok {
+		panic(fmt.Sprintf("controller %T does not support float32 inference", c))
+	}
+	inf := Inference32{
+		C:       c,
+		Model:   model,
+		weights: Float32Weights(c),
+		banks:   make([]memoryInference32, len(controllerMemories(c))),
+		mems:    controllerMemories(c),
+	}
+	inf.cntl = ci.inference32(inf.weights)
+	out := inf.cntl.output()
+	inf.ySize = len(out) - inf.mems.numHeadUnits()
+	inf.heads = newHeads32(inf.mems, out[inf.ySize:])
+	inf.reads = make([]float32, inf.mems.numReadUnits())
+	inf.y = make([]float64, inf.ySize)
+	inf.numHeads = make([]int, len(inf.mems))
+	for b, mem := range inf.mems {
+		inf.banks[b] = newMemoryInference32(mem)
+		inf.numHeads[b] = len(mem.emptyHeads())
+	}
+	inf.Reset()
+	return &inf
+}
+
+// Float32Weights returns the weights of c converted to float32.
+func Float32Weights(c Controller) []float32 {
+	weights := make([]float32, len(c.WeightsVal()))
+	for i, w := range c.WeightsVal() {
+		weights[i] = float32(w)
+	}
+	return weights
+}
+
+// LoadWeights converts the weights of C to float32 again, which is needed after the weights of C are updated.
+// The biases of the initial weights and memory take effect at the next Reset.
+func (inf *Inference32) LoadWeights() {
+	for i, w := range inf.C.WeightsVal() {
+		inf.weights[i] = float32(w)
+	}
+}
+
+// Step feeds x to the NTM, and returns its output after being transformed by the DensityModel.
+// The returned output is valid until the next call to Step or Reset.
+func (inf *Inference32) Step(x []float64) []float64 {
+	if inf.x == nil {
+		inf.x = make([]float32, len(x))
+	}
+	for i, v := range x {
+		inf.x[i] = float32(v)
+	}
+	inf.cntl.forward(inf.reads, inf.x)
+	heads := inf.heads
+	reads := inf.reads
+	for b, mem := range inf.mems {
+		nr := mem.numReads() * mem.readSize()
+		inf.banks[b].step(heads[:inf.numHeads[b]], reads[:nr])
+		heads = heads[inf.numHeads[b]:]
+		reads = reads[nr:]
+	}
+	for i, v := range inf.cntl.output()[:inf.ySize] {
+		inf.y[i] = float64(v)
+	}
+	inf.Model.Transform(inf.y)
+	return inf.y
+}
+
+// Reset resets the memory, head weights and reads of the NTM to their bias values, as in MakeEmptyNTM,
+// and the states of the controller to 0.
+func (inf *Inference32) Reset() {
+	inf.cntl.reset()
+	// The biases of the initial weights and memory are at the end of the weights of all controllers.
+	wtm1 := inf.weights[len(inf.weights)-len(inf.C.Mtm1BiasVal())-len(inf.C.Wtm1BiasVal()):]
+	mtm1 := inf.weights[len(inf.weights)-len(inf.C.Mtm1BiasVal()):]
+	reads := inf.reads
+	for b, mem := range inf.mems {
+		nw := mem.numWeightings() * mem.N
+		nm := mem.N * mem.M
+		nr := mem.numReads() * mem.readSize()
+		inf.banks[b].reset(wtm1[:nw], mtm1[:nm], reads[:nr])
+		wtm1 = wtm1[nw:]
+		mtm1 = mtm1[nm:]
+		reads = reads[nr:]
+	}
+}
+
+// Divergence32 returns the largest absolute difference between the outputs of the Inference32 of c on the inputs x,
+// which are transformed by model, and predictions, which are the outputs of c on x in float64 such as those returned
+// by Predictions. It measures the precision lost by running c in float32.
+func Divergence32(c Controller, model DensityModel, x, predictions [][]float64) float64 {
+	inf := NewInference32(c, model)
+	var d float64 = 0
+	for t := range x {
+		for i, y := range inf.Step(x[t]) {
+			d = math.Max(d, math.Abs(y-predictions[t][i]))
+		}
+	}
+	return d
+}
+
+// An inferrer32 is the float32 counterpart of inferrer.
+type inferrer32 interface {
+	// inference32 returns a controllerInference32 which runs this Controller forward with the float32 weights,
+	// as in Inference32.
+	inference32(weights []float32) controllerInference32
+}
+
+// A controllerInference32 is the float32 counterpart of controllerInference.
+type controllerInference32 interface {
+	forward(reads, x []float32)
+	output() []float32
+	reset()
+}
+
+// A memoryInference32 is the float32 counterpart of memoryInference.
+type memoryInference32 interface {
+	step(heads []*head32, reads []float32)
+	reset(wtm1, mtm1, reads []float32)
+}
+
+func newMemoryInference32(mem MemorySpec) memoryInference32 {
+	if mem.DNC {
+		return newDNCInference32(mem)
+	}
+	if mem.SparseK > 0 {
+		return newSparseInference32(mem)
+	}
+	return newMemOpInference32(mem)
+}
+
+// general32 returns a float32 matrix with the same layout as g, whose data start at offset in weights.
+func general32(g blas64.General, weights []float32, offset int) blas32.General {
+	return blas32.General{Rows: g.Rows, Cols: g.Cols, Stride: g.Stride, Data: weights[offset : offset+len(g.Data)]}
+}
+
+// head32 is a Head whose units are float32, which are accessed by the unexported methods below instead of
+// the methods of Head.
+type head32 struct {
+	*Head
+	vals []float32
+}
+
+// newHeads32 creates the heads of all banks whose units are stored in vals, as in memories.newHeads.
+func newHeads32(ms memories, vals []float32) []*head32 {
+	heads := make([]*head32, 0, ms.numWeightings()+len(ms))
+	for _, m := range ms {
+		for _, h := range m.emptyHeads() {
+			n := h.unitsLen()
+			heads = append(heads, &head32{Head: h, vals: vals[:n]})
+			vals = vals[n:]
+		}
+	}
+	return heads
+}
+
+func (h *head32) erase() []float32 {
+	return h.vals[0:h.M]
+}
+
+func (h *head32) add() []float32 {
+	return h.vals[h.M : 2*h.M]
+}
+
+func (h *head32) k() []float32 {
+	return h.vals[h.kOffset():h.betaOffset()]
+}
+
+func (h *head32) beta() float32 {
+	return h.vals[h.betaOffset()]
+}
+
+func (h *head32) g() float32 {
+	return h.vals[h.betaOffset()+1]
+}
+
+func (h *head32) s() float32 {
+	return h.vals[h.betaOffset()+2]
+}
+
+func (h *head32) shift() []float32 {
+	return h.vals[h.betaOffset()+2 : h.betaOffset()+2+h.shiftLen()]
+}
+
+func (h *head32) gamma() float32 {
+	return h.vals[h.betaOffset()+2+h.shiftLen()]
+}
+
+func (h *head32) alpha() float32 {
+	return h.vals[h.betaOffset()+3+h.shiftLen()]
+}
+
+func (h *head32) free() float32 {
+	return h.vals[h.betaOffset()+1]
+}
+
+func (h *head32) readModes() []float32 {
+	return h.vals[h.betaOffset()+2 : h.betaOffset()+5]
+}
+
+func (h *head32) allocGate() float32 {
+	return h.vals[h.betaOffset()+1]
+}
+
+func (h *head32) writeGate() float32 {
+	return h.vals[h.betaOffset()+2]
+}
+
+// memOpInference32 is the float32 counterpart of memOpInference.
+type memOpInference32 struct {
+	spec MemorySpec
+	mem  []float32
+	w    [][]float32
+
+	wc    []float32
+	wg    []float32
+	sw    []float32
+	shift []float32
+
+	ws    [][]float32
+	lw    [][]float32
+	erase [][]float32
+	add   [][]float32
+
+	usage     []float32
+	leastUsed []float32
+	order     *usageOrder32
+}
+
+func newMemOpInference32(mem MemorySpec) *memOpInference32 {
+	numHeads := mem.numWeightings()
+	mi := memOpInference32{
+		spec:  mem,
+		mem:   make([]float32, mem.N*mem.M),
+		w:     makeTensor2Float32(numHeads, mem.N),
+		wc:    make([]float32, mem.N),
+		wg:    make([]float32, mem.N),
+		sw:    make([]float32, mem.N),
+		shift: make([]float32, mem.ShiftWidth),
+		ws:    make([][]float32, 0, numHeads),
+		lw:    makeTensor2Float32(numHeads, mem.N),
+		erase: makeTensor2Float32(numHeads, mem.M),
+		add:   makeTensor2Float32(numHeads, mem.M),
+	}
+	if mem.LRUA {
+		mi.usage = make([]float32, mem.N)
+		mi.leastUsed = make([]float32, mem.N)
+		mi.order = newUsageOrder32(mi.usage)
+	}
+	return &mi
+}
+
+func (mi *memOpInference32) reset(wtm1, mtm1, reads []float32) {
+	copy(mi.mem, mtm1)
+	for i, w := range mi.w {
+		copy(w, wtm1[i*mi.spec.N:(i+1)*mi.spec.N])
+		softmax32(w)
+	}
+	rs := mi.spec.readSize()
+	for i := 0; i < mi.spec.numReads(); i++ {
+		readMemory32(mi.w[i], mi.mem, mi.spec.M, mi.spec.KeySize, reads[i*rs:(i+1)*rs])
+	}
+	if mi.usage != nil {
+		for i := range mi.usage {
+			mi.usage[i] = 0
+		}
+		mi.order.leastUsed(mi.leastUsed, len(mi.w))
+	}
+}
+
+func (mi *memOpInference32) step(heads []*head32, reads []float32) {
+	n := mi.spec.N
+	rs := mi.spec.readSize()
+	mi.ws = mi.ws[:0]
+	for i, h := range heads {
+		wtm1 := mi.w[i]
+		contentWeights32(h, mi.mem, mi.wc)
+		g := sigmoid32(h.g())
+		for j := range mi.wg {
+			mi.wg[j] = g*mi.wc[j] + (1-g)*wtm1[j]
+		}
+		if h.ShiftWidth > 0 {
+			copy(mi.shift, h.shift())
+			softmax32(mi.shift)
+			for j := range mi.sw {
+				mi.sw[j] = 0
+				for k, s := range mi.shift {
+					offset := k - len(mi.shift)/2
+					mi.sw[j] += mi.wg[((j-offset)%n+n)%n] * s
+				}
+			}
+		} else {
+			z := math.Mod(2*Sigmoid(float64(h.s()))-1+float64(n), float64(n))
+			simj := float32(1 - (z - math.Floor(z)))
+			for j := range mi.sw {
+				imj := (j + int(z)) % n
+				mi.sw[j] = mi.wg[imj]*simj + mi.wg[(imj+1)%n]*(1-simj)
+			}
+		}
+
+		if h.writes() {
+			k := len(mi.ws)
+			if h.kind == lruaHead {
+				alpha := sigmoid32(h.alpha())
+				for j, lu := range mi.leastUsed {
+					mi.lw[k][j] = alpha*wtm1[j] + (1-alpha)*lu
+				}
+				mi.ws = append(mi.ws, mi.lw[k])
+			} else {
+				mi.ws = append(mi.ws, wtm1)
+			}
+			addVec := h.add()
+			for j, e := range h.erase() {
+				mi.erase[k][j] = sigmoid32(e)
+				mi.add[k][j] = sigmoid32(addVec[j])
+			}
+		}
+
+		gamma := math.Log(math.Exp(float64(h.gamma()))+1) + 1
+		var sum float32 = 0
+		for j, v := range mi.sw {
+			wtm1[j] = float32(math.Pow(float64(v), gamma))
+			sum += wtm1[j]
+		}
+		for j := range wtm1 {
+			wtm1[j] = wtm1[j] / sum
+		}
+		if h.reads() {
+			readMemory32(wtm1, mi.mem, mi.spec.M, mi.spec.KeySize, reads[:rs])
+			reads = reads[rs:]
+		}
+	}
+	writeMemory32(mi.mem, mi.spec.M, mi.ws, mi.erase, mi.add)
+
+	if mi.usage == nil {
+		return
+	}
+	decay := float32(mi.spec.UsageDecay)
+	for j, u := range mi.usage {
+		mi.usage[j] = decay * u
+		for i, h := range heads {
+			if h.reads() {
+				mi.usage[j] += mi.w[i][j]
+			}
+		}
+		for _, w := range mi.ws {
+			mi.usage[j] += w[j]
+		}
+	}
+	mi.order.leastUsed(mi.leastUsed, len(mi.w))
+}
+
+func sigmoid32(x float32) float32 {
+	return float32(Sigmoid(float64(x)))
+}
+
+func tanh32(x float32) float32 {
+	return float32(math.Tanh(float64(x)))
+}
+
+func makeTensor2Float32(n, m int) [][]float32 {
+	t := make([][]float32, n)
+	for i := range t {
+		t[i] = make([]float32, m)
+	}
+	return t
+}
+
+// similarity32 is the float32 counterpart of Similarity.value.
+func similarity32(s Similarity, u, v []float32) float32 {
+	switch s {
+	case DotSimilarity:
+		return blas32.Dot(len(u), blas32.Vector{Inc: 1, Data: u}, blas32.Vector{Inc: 1, Data: v})
+	case EuclideanSimilarity:
+		var sum float32 = 0
+		for i, ui := range u {
+			d := ui - v[i]
+			sum += d * d
+		}
+		return -float32(math.Sqrt(float64(sum)))
+	}
+	var sum float32 = 0
+	var usum float32 = 0
+	var vsum float32 = 0
+	for i := range u {
+		sum += u[i] * v[i]
+		usum += u[i] * u[i]
+		vsum += v[i] * v[i]
+	}
+	return sum / float32(math.Sqrt(float64(usum*vsum)))
+}
+
+// contentWeights32 is the float32 counterpart of contentWeights.
+func contentWeights32(h *head32, mem []float32, w []float32) {
+	b := float32(math.Exp(float64(h.beta())))
+	k := h.k()
+	for i := range w {
+		w[i] = b * similarity32(h.Similarity, k, mem[i*h.M:i*h.M+h.keyLen()])
+	}
+	softmax32(w)
+}
+
+// softmax32 is the float32 counterpart of softmax.
+func softmax32(x []float32) {
+	var max float32 = -math.MaxFloat32
+	for _, v := range x {
+		if v > max {
+			max = v
+		}
+	}
+	var sum float32 = 0
+	for i, v := range x {
+		x[i] = float32(math.Exp(float64(v - max)))
+		sum += x[i]
+	}
+	for i, v := range x {
+		x[i] = v / sum
+	}
+}
+
+// readMemory32 is the float32 counterpart of readMemory.
+func readMemory32(w, mem []float32, m, offset int, r []float32) {
+	memory := blas32.General{Rows: len(w), Cols: m - offset, Stride: m, Data: mem[offset:]}
+	blas32.Gemv(blas.Trans, 1, memory, blas32.Vector{Inc: 1, Data: w}, 0, blas32.Vector{Inc: 1, Data: r})
+}
+
+// writeMemory32 is the float32 counterpart of writeMemory.
+func writeMemory32(mem []float32, m int, ws, erase, add [][]float32) {
+	for i := range mem {
+		j, c := i/m, i%m
+		v := mem[i]
+		for k, w := range ws {
+			v *= 1 - w[j]*erase[k][c]
+		}
+		for k, w := range ws {
+			v += w[j] * add[k][c]
+		}
+		mem[i] = v
+	}
+}
+
+// usageOrder32 is the float32 counterpart of usageOrder.
+type usageOrder32 struct {
+	usage []float32
+	order []int
+}
+
+func newUsageOrder32(usage []float32) *usageOrder32 {
+	return &usageOrder32{usage: usage, order: make([]int, len(usage))}
+}
+
+func (o *usageOrder32) Len() int           { return len(o.order) }
+func (o *usageOrder32) Less(a, b int) bool { return o.usage[o.order[a]] < o.usage[o.order[b]] }
+func (o *usageOrder32) Swap(a, b int)      { o.order[a], o.order[b] = o.order[b], o.order[a] }
+
+func (o *usageOrder32) sort() []int {
+	for i := range o.order {
+		o.order[i] = i
+	}
+	sort.Stable(o)
+	return o.order
+}
+
+func (o *usageOrder32) leastUsed(lu []float32, n int) {
+	for i := range lu {
+		lu[i] = 0
+	}
+	if n > len(lu) {
+		n = len(lu)
+	}
+	for _, i := range o.sort()[:n] {
+		lu[i] = 1
+	}
+}
@@ -0,0 +1,83 @@
+package ntm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// inference32Controllers returns the controllers of inferenceControllers, except that the DNC memory of the banks
+// controller has keys of size 2 instead of 1.
+// The cosine similarities of keys of size 1 are all either 1 or -1, and float32 rounding breaks the resulting ties in
+// the usage of DNC memory locations differently from float64, which then allocates different locations.
+func inference32Controllers() map[string]Controller {
+	cs := inferenceControllers()
+	cs["banks"] = NewEmptyController1WithMemory(3, 3, 4,
+		MemorySpec{N: 4, M: 4, NumReadHeads: 1, NumWriteHeads: 1, KeySize: 2},
+		MemorySpec{N: 5, M: 4, NumHeads: 1, DNC: true, KeySize: 2},
+		MemorySpec{N: 6, M: 4, NumHeads: 1, NumReadHeads: 1, SparseK: 2, KeySize: 2})
+	return cs
+}
+
+func TestInference32(t *testing.T) {
+	for name, c := range inference32Controllers() {
+		weights := c.WeightsVal()
+		for i := range weights {
+			weights[i] = 2*rand.Float64() - 1
+		}
+		x := makeTensor2(12, 3)
+		for i := range x {
+			for j := range x[i] {
+				x[i][j] = rand.Float64()
+			}
+		}
+
+		inf := NewInference(c, &MultinomialModel{})
+		inf32 := NewInference32(c, &MultinomialModel{})
+		for i := range x {
+			y := inf.Step(x[i])
+			for j, v := range inf32.Step(x[i]) {
+				if math.Abs(v-y[j]) > 1e-4 {
+					t.Errorf("%s: output[%d][%d] %f, expected %f", name, i, j, v, y[j])
+				}
+			}
+		}
+
+		if allocs := testing.AllocsPerRun(10, func() { inf32.Step(x[0]) }); allocs != 0 {
+			t.Errorf("%s: %f allocations per time step", name, allocs)
+		}
+	}
+}
+
+func TestDivergence32(t *testing.T) {
+	c := NewEmptyController1(3, 2, 4, 2, 5, 3)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+	x := makeTensor2(8, 3)
+	y := makeTensor2(8, 2)
+	for i := range x {
+		for j := range x[i] {
+			x[i][j] = rand.Float64()
+		}
+	}
+	predictions := Predictions(ForwardBackward(c, x, &LogisticModel{Y: y}))
+	if d := Divergence32(c, &LogisticModel{}, x, predictions); d > 1e-4 {
+		t.Errorf("divergence %g, expected at most 1e-4", d)
+	}
+	predictions[5][1] += 0.5
+	if d := Divergence32(c, &LogisticModel{}, x, predictions); math.Abs(d-0.5) > 1e-4 {
+		t.Errorf("divergence %g, expected 0.5", d)
+	}
+}
+
+func BenchmarkInference32(b *testing.B) {
+	inf := NewInference32(benchmarkController(), &LogisticModel{})
+	x := make([]float64, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inf.Step(x)
+	}
+}
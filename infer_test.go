@@ -0,0 +1,86 @@
+package ntm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func inferenceControllers() map[string]Controller {
+	return map[string]Controller{
+		"controller1": NewEmptyController1(3, 3, 4, 2, 5, 3),
+		"feedforward": NewEmptyFeedforwardControllerWithMemory(3, 3, []Layer{{Size: 4, Activation: TanhActivation}, {Size: 3, Activation: ReLUActivation}},
+			MemorySpec{N: 5, M: 3, NumHeads: 1, ShiftWidth: 3, Similarity: EuclideanSimilarity}),
+		"lrua":   NewEmptyGRUControllerWithMemory(3, 3, 4, MemorySpec{N: 6, M: 2, NumHeads: 2, LRUA: true, UsageDecay: 0.9}),
+		"lrua3":  NewEmptyGRUControllerWithMemory(3, 3, 4, MemorySpec{N: 2, M: 2, NumHeads: 3, LRUA: true}),
+		"dnc":    NewEmptyLSTMControllerWithMemory(3, 3, 4, MemorySpec{N: 5, M: 3, NumHeads: 2, DNC: true, Similarity: DotSimilarity}),
+		"sparse": NewEmptyGRUControllerWithMemory(3, 3, 4, MemorySpec{N: 9, M: 3, NumHeads: 2, SparseK: 3}),
+		"banks": NewEmptyController1WithMemory(3, 3, 4,
+			MemorySpec{N: 4, M: 4, NumReadHeads: 1, NumWriteHeads: 1, KeySize: 2},
+			MemorySpec{N: 5, M: 3, NumHeads: 1, DNC: true, KeySize: 1},
+			MemorySpec{N: 6, M: 4, NumHeads: 1, NumReadHeads: 1, SparseK: 2, KeySize: 2}),
+	}
+}
+
+func TestInference(t *testing.T) {
+	for name, c := range inferenceControllers() {
+		weights := c.WeightsVal()
+		for i := range weights {
+			weights[i] = 2*rand.Float64() - 1
+		}
+		x := makeTensor2(12, 3)
+		y := make([]int, len(x))
+		for i := range x {
+			for j := range x[i] {
+				x[i][j] = rand.Float64()
+			}
+			y[i] = rand.Intn(3)
+		}
+		expected := Predictions(ForwardBackward(c, x, &MultinomialModel{Y: y}))
+
+		inf := NewInference(c, &MultinomialModel{})
+		for k := 0; k < 2; k++ {
+			for i := range x {
+				checkRunnerOutput(t, name, i, inf.Step(x[i]), expected[i])
+			}
+			inf.Reset()
+		}
+
+		if allocs := testing.AllocsPerRun(10, func() { inf.Step(x[0]) }); allocs != 0 {
+			t.Errorf("%s: %f allocations per time step", name, allocs)
+		}
+	}
+}
+
+// benchmarkController returns a controller of the size used in the copy task.
+func benchmarkController() Controller {
+	c := NewEmptyController1(10, 10, 100, 1, 128, 20)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+	return c
+}
+
+func BenchmarkNewNTM(b *testing.B) {
+	c := benchmarkController()
+	x := make([]float64, 10)
+	model := &LogisticModel{}
+	m := MakeEmptyNTM(c)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m = NewNTM(m, x)
+		model.Transform(m.Controller.YVal())
+		m = m.truncate()
+	}
+}
+
+func BenchmarkInference(b *testing.B) {
+	inf := NewInference(benchmarkController(), &LogisticModel{})
+	x := make([]float64, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		inf.Step(x)
+	}
+}
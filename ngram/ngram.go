@@ -16,8 +16,12 @@ func GenProb() []float64 {
 }
 
 func GenSeq(prob []float64) ([][]float64, [][]float64) {
+	return GenSeqLen(prob, 200)
+}
+
+// GenSeqLen is like GenSeq, except that the generated sequence is of length seqLen.
+func GenSeqLen(prob []float64, seqLen int) ([][]float64, [][]float64) {
 	n := int(math.Log2(float64(len(prob))))
-	seqLen := 200
 
 	input := make([][]float64, seqLen+1)
 	for i := 0; i < n; i++ {
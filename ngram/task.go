@@ -0,0 +1,46 @@
+package ngram
+
+import (
+	"fmt"
+
+	"ntm"
+	"ntm/task"
+)
+
+func init() {
+	task.Register("ngram", func(string) (task.Task, error) {
+		return &Task{SeqLen: 200}, nil
+	})
+}
+
+// Task is the dynamic n-grams task as a task.Task, in which each sequence of length SeqLen is generated from a newly
+// generated probability lookup table.
+type Task struct {
+	SeqLen int
+}
+
+func (t *Task) InputSize() int {
+	return 1
+}
+
+func (t *Task) OutputSize() int {
+	return 1
+}
+
+func (t *Task) Sample() task.Seq {
+	x, y := GenSeqLen(GenProb(), t.SeqLen)
+	return task.Seq{X: x, Y: y, Model: &ntm.LogisticModel{Y: y}}
+}
+
+// Loss returns the logistic loss of the sequence in nats, which is not normalized by its length.
+func (t *Task) Loss(seq task.Seq, predictions [][]float64) float64 {
+	return seq.Model.Loss(predictions)
+}
+
+func (t *Task) Evals() []task.Eval {
+	evals := make([]task.Eval, 0)
+	for i := 1; i <= 3; i++ {
+		evals = append(evals, task.Eval{Name: fmt.Sprintf("lookup table %d", i), Sample: t.Sample})
+	}
+	return evals
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"html/template"
 	"log"
@@ -13,7 +12,7 @@ import (
 )
 
 var (
-	weightsFile = flag.String("weightsFile", "", "trained weights in JSON")
+	weightsFile = flag.String("weightsFile", "", "a checkpoint or trained weights in JSON")
 )
 
 type Run struct {
@@ -36,8 +35,20 @@ func main() {
 	numHeads := 1
 	n := 128
 	m := 20
-	c := ntm.NewEmptyController1(1, 1, h1Size, numHeads, n, m)
-	weightsFromFile(c)
+	spec := ntm.ControllerSpec{Type: ntm.Controller1Type, XSize: 1, YSize: 1, HSize: h1Size, Memories: []ntm.MemorySpec{{N: n, M: m, NumHeads: numHeads}}}
+	if *weightsFile == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	ck, err := ntm.LoadCheckpoint(*weightsFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	// Bare arrays of weights dumped before checkpoints existed are of the controller described by spec.
+	c, err := ck.NewControllerWithDefault(spec)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	runs := make([]Run, 0)
 	for i := 0; i < 1; i++ {
@@ -168,20 +179,3 @@ func root(runs []Run) func(http.ResponseWriter, *http.Request) {
 		rootTmpl.Execute(w, page)
 	}
 }
-
-func weightsFromFile(c ntm.Controller) {
-	if *weightsFile == "" {
-		flag.PrintDefaults()
-		os.Exit(1)
-	}
-
-	f, err := os.Open(*weightsFile)
-	if err != nil {
-		log.Fatalf("%v", err)
-	}
-	defer f.Close()
-	ws := c.WeightsVal()
-	if err := json.NewDecoder(f).Decode(&ws); err != nil {
-		log.Fatalf("%v", err)
-	}
-}
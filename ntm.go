@@ -13,15 +13,44 @@ import (
 	"github.com/gonum/blas/blas64"
 )
 
-// A Head is a read write head on a memory bank.
+// A Head is a read write, read only or write only head on a memory bank.
 // It carriess information that is required to operate on a memory bank according to the NTM architecture.
 type Head struct {
 	vals  []float64
 	grads []float64
 
-	Wtm1 *refocus // the weights at time t-1
-	M    int      // size of a row in the memory
-}
+	Wtm1  *refocus  // the weights at time t-1
+	LUtm1 []float64 // the least used locations at time t-1, which is only used in least recently used access
+	M     int       // size of a row in the memory
+
+	// ShiftWidth is the size of the shift distribution emitted by the head, see MemorySpec.ShiftWidth.
+	ShiftWidth int
+	// Similarity is the similarity measure used in content addressing.
+	Similarity Similarity
+	// KeySize is the size of the key part of a memory vector in key value memories, see MemorySpec.KeySize.
+	KeySize int
+
+	kind      headKind
+	readOnly  bool
+	writeOnly bool
+}
+
+// headKind is the addressing scheme of a head, which determines the units it emits.
+// Heads that write emit the erase and add vectors before the units listed below, and read only heads do not.
+type headKind int
+
+const (
+	// ntmHead is a NTM head, whose units are laid out as |k|beta|g|shift|gamma|.
+	ntmHead headKind = iota
+	// dncHead is a DNC head. The units of a read head are laid out as |k|beta|free|read modes|, and
+	// the units of the write head are laid out as |k|beta|allocation gate|write gate|.
+	dncHead
+	// lruaHead is a NTM head that writes with least recently used access, whose units are laid out as
+	// |k|beta|g|shift|gamma|alpha|, where alpha is emitted only by heads that write.
+	lruaHead
+	// sparseHead is a head in sparse access mode, whose units are laid out as |k|beta|.
+	sparseHead
+)
 
 // NewHead creates a new memory head.
 func NewHead(m int) *Head {
@@ -51,51 +80,304 @@ func (h *Head) AddGrad() []float64 {
 
 // KVal: K returns a head's key vector, which is the target data in the content addressing step.
 func (h *Head) KVal() []float64 {
-	return h.vals[2*h.M : 3*h.M]
+	return h.vals[h.kOffset():h.betaOffset()]
 }
 
 func (h *Head) KGrad() []float64 {
-	return h.grads[2*h.M : 3*h.M]
+	return h.grads[h.kOffset():h.betaOffset()]
 }
 
 // BetaVal: Beta returns the key strength of a content addressing step.
 func (h *Head) BetaVal() *float64 {
-	return &h.vals[3*h.M]
+	return &h.vals[h.betaOffset()]
 }
 
 func (h *Head) BetaGrad() *float64 {
-	return &h.grads[3*h.M]
+	return &h.grads[h.betaOffset()]
 }
 
 // GVal: G returns the degree in which we want to choose content-addressing over location-based-addressing.
 func (h *Head) GVal() *float64 {
-	return &h.vals[3*h.M+1]
+	return &h.vals[h.betaOffset()+1]
 }
 
 func (h *Head) GGrad() *float64 {
-	return &h.grads[3*h.M+1]
+	return &h.grads[h.betaOffset()+1]
 }
 
 // SVal: S returns a value indicating how much the weightings are rotated in a location-based-addressing step.
+// It is only meaningful when the head emits a scalar shift, in which case ShiftWidth is 0.
 func (h *Head) SVal() *float64 {
-	return &h.vals[3*h.M+2]
+	return &h.vals[h.betaOffset()+2]
 }
 
 func (h *Head) SGrad() *float64 {
-	return &h.grads[3*h.M+2]
+	return &h.grads[h.betaOffset()+2]
+}
+
+// ShiftVal returns the unnormalized distribution over the allowed shifts in a convolutional shift.
+// When ShiftWidth is 0, the returned slice contains the single scalar shift S.
+func (h *Head) ShiftVal() []float64 {
+	return h.vals[h.betaOffset()+2 : h.betaOffset()+2+h.shiftLen()]
+}
+
+func (h *Head) ShiftGrad() []float64 {
+	return h.grads[h.betaOffset()+2 : h.betaOffset()+2+h.shiftLen()]
 }
 
 // GammaVal: Gamma returns the degree in which the addressing weights are sharpened.
 func (h *Head) GammaVal() *float64 {
-	return &h.vals[3*h.M+3]
+	return &h.vals[h.betaOffset()+2+h.shiftLen()]
 }
 
 func (h *Head) GammaGrad() *float64 {
-	return &h.grads[3*h.M+3]
+	return &h.grads[h.betaOffset()+2+h.shiftLen()]
+}
+
+// AlphaVal returns the gate of a least recently used access head,
+// which interpolates between writing to the locations read at time t-1 and the least used locations.
+func (h *Head) AlphaVal() *float64 {
+	return &h.vals[h.betaOffset()+3+h.shiftLen()]
+}
+
+func (h *Head) AlphaGrad() *float64 {
+	return &h.grads[h.betaOffset()+3+h.shiftLen()]
+}
+
+// FreeVal returns the free gate of a DNC read head, which decides whether the locations read at time t-1 can be freed.
+func (h *Head) FreeVal() *float64 {
+	return &h.vals[h.betaOffset()+1]
+}
+
+func (h *Head) FreeGrad() *float64 {
+	return &h.grads[h.betaOffset()+1]
+}
+
+// ReadModeVal returns the unnormalized read modes of a DNC read head,
+// which interpolate between the backward, content and forward weightings.
+func (h *Head) ReadModeVal() []float64 {
+	return h.vals[h.betaOffset()+2 : h.betaOffset()+5]
+}
+
+func (h *Head) ReadModeGrad() []float64 {
+	return h.grads[h.betaOffset()+2 : h.betaOffset()+5]
+}
+
+// AllocGateVal returns the allocation gate of a DNC write head,
+// which interpolates between writing to newly allocated locations and content addressing.
+func (h *Head) AllocGateVal() *float64 {
+	return &h.vals[h.betaOffset()+1]
+}
+
+func (h *Head) AllocGateGrad() *float64 {
+	return &h.grads[h.betaOffset()+1]
+}
+
+// WriteGateVal returns the write gate of a DNC write head, which decides how much is written at all.
+func (h *Head) WriteGateVal() *float64 {
+	return &h.vals[h.betaOffset()+2]
+}
+
+func (h *Head) WriteGateGrad() *float64 {
+	return &h.grads[h.betaOffset()+2]
+}
+
+func (h *Head) shiftLen() int {
+	if h.ShiftWidth == 0 {
+		return 1
+	}
+	return h.ShiftWidth
+}
+
+// reads returns whether the head reads from memory.
+func (h *Head) reads() bool {
+	return !h.writeOnly
+}
+
+// writes returns whether the head writes to memory.
+func (h *Head) writes() bool {
+	return !h.readOnly
+}
+
+// kOffset returns the position of the key vector, which follows the erase and add vectors of heads that write.
+func (h *Head) kOffset() int {
+	if h.writes() {
+		return 2 * h.M
+	}
+	return 0
+}
+
+// keyLen returns the size of the key vector, which is the size of the key part of a memory vector in key value memories.
+func (h *Head) keyLen() int {
+	if h.KeySize > 0 {
+		return h.KeySize
+	}
+	return h.M
+}
+
+// betaOffset returns the position of the key strength, which follows the key vector.
+func (h *Head) betaOffset() int {
+	return h.kOffset() + h.keyLen()
+}
+
+// unitsLen returns the number of units emitted by the controller for a head.
+func (h *Head) unitsLen() int {
+	n := h.betaOffset() + 1
+	switch h.kind {
+	case dncHead:
+		if h.writes() {
+			return n + 2
+		}
+		return n + 4
+	case lruaHead:
+		if h.writes() {
+			return n + 3 + h.shiftLen()
+		}
+	case sparseHead:
+		return n
+	}
+	return n + 2 + h.shiftLen()
+}
+
+// A MemorySpec describes a memory bank and the heads that operate on it.
+type MemorySpec struct {
+	N        int // the number of vectors in the memory bank
+	M        int // the size of a vector in the memory bank
+	NumHeads int // the number of heads that both read and write
+
+	// NumReadHeads is the number of heads that only read, which do not emit erase and add vectors.
+	NumReadHeads int
+	// NumWriteHeads is the number of heads that only write.
+	// The heads of a controller are laid out as the read write heads, followed by the read only and write only heads.
+	NumWriteHeads int
+
+	// ShiftWidth is the number of allowed shifts in the location-based addressing step.
+	// If ShiftWidth is positive, each head emits a softmax distribution over the shifts
+	// -ShiftWidth/2, ..., (ShiftWidth-1)/2, which is circularly convolved with the gated weighting
+	// as described in the paper. For example, a ShiftWidth of 3 allows the shifts -1, 0 and +1.
+	// If ShiftWidth is 0, each head emits a single scalar shift in the range (-1, 1),
+	// which linearly interpolates between two neighbouring locations.
+	ShiftWidth int
+
+	// Similarity is the similarity measure between a head's key vector and a memory vector in content addressing.
+	// The zero value is the cosine similarity as in the paper.
+	Similarity Similarity
+
+	// DNC selects the memory of a Differentiable Neural Computer instead of the NTM memory, see dncOp.
+	// In this case, NumHeads is the number of read heads, which are followed by a single write head,
+	// and NumReadHeads and NumWriteHeads are ignored.
+	// ShiftWidth is ignored, since DNC heads address memory by content and by temporal links only.
+	DNC bool
+
+	// LRUA selects the least recently used access for writing, as described in
+	// A. Santoro et al. One-shot learning with memory-augmented neural networks. arXiv preprint arXiv:1605.06065, 2016.
+	// Instead of writing where it reads, each head writes to an interpolation of the locations it read at time t-1
+	// and the least used locations, which is controlled by an additional gate unit Alpha.
+	// If there are more heads than locations, all locations are taken as the least used.
+	// LRUA is ignored if DNC is set.
+	LRUA bool
+	// UsageDecay is the factor by which the usage of memory locations decays in every time step in least recently used access.
+	UsageDecay float64
+
+	// SparseK selects the sparse access mode if positive, in which each head reads and writes only the SparseK memory
+	// locations that are most similar to its key, see sparseOp.
+	// The heads then address memory by content only, and ShiftWidth and LRUA are ignored.
+	// SparseK is ignored if DNC is set.
+	SparseK int
+
+	// KeySize selects a key value memory if positive, in which the first KeySize elements of each memory vector are
+	// its key, and the remaining M-KeySize elements are its value.
+	// Heads then emit keys of size KeySize, which are compared only against the keys of memory vectors in
+	// content addressing, and read only the values. Since the erase and add vectors span both parts,
+	// heads can write to the keys and values independently.
+	KeySize int
+}
+
+func (s MemorySpec) newHead() *Head {
+	h := NewHead(s.M)
+	h.ShiftWidth = s.ShiftWidth
+	h.Similarity = s.Similarity
+	h.KeySize = s.KeySize
+	return h
+}
+
+// emptyHeads creates the heads described by s, without their units.
+func (s MemorySpec) emptyHeads() []*Head {
+	if s.DNC {
+		heads := make([]*Head, s.NumHeads+1)
+		for i := range heads {
+			heads[i] = s.newHead()
+			heads[i].kind = dncHead
+			heads[i].readOnly = i < s.NumHeads
+			heads[i].writeOnly = i == s.NumHeads
+		}
+		return heads
+	}
+
+	heads := make([]*Head, s.NumHeads+s.NumReadHeads+s.NumWriteHeads)
+	for i := range heads {
+		heads[i] = s.newHead()
+		heads[i].readOnly = i >= s.NumHeads && i < s.NumHeads+s.NumReadHeads
+		heads[i].writeOnly = i >= s.NumHeads+s.NumReadHeads
+	}
+	if s.SparseK > 0 {
+		for _, h := range heads {
+			h.kind = sparseHead
+		}
+	} else if s.LRUA {
+		for _, h := range heads {
+			h.kind = lruaHead
+		}
+	}
+	return heads
 }
 
-func headUnitsLen(m int) int {
-	return 3*m + 4
+// numReads returns the number of vectors read from memory in a time step, which are inputs to the controller.
+func (s MemorySpec) numReads() int {
+	if s.DNC {
+		return s.NumHeads
+	}
+	return s.NumHeads + s.NumReadHeads
+}
+
+// readSize returns the size of a vector read from memory, which is the size of the value part in key value memories.
+func (s MemorySpec) readSize() int {
+	return s.M - s.KeySize
+}
+
+// numWeightings returns the number of heads whose addressing weights at time t-1 are carried to time t,
+// which is the number of initial weights in the bias of a controller.
+// This is the number of all heads except the write head of a DNC.
+func (s MemorySpec) numWeightings() int {
+	if s.DNC {
+		return s.NumHeads
+	}
+	return s.NumHeads + s.NumReadHeads + s.NumWriteHeads
+}
+
+// numHeadUnits returns the number of units emitted by the controller for all heads.
+func (s MemorySpec) numHeadUnits() int {
+	n := 0
+	for _, h := range s.emptyHeads() {
+		n += h.unitsLen()
+	}
+	return n
+}
+
+// newHeads creates the heads whose units are stored in vals and grads.
+// grads is nil for heads that are only run forward, as in Inference.
+func (s MemorySpec) newHeads(vals, grads []float64) []*Head {
+	heads := s.emptyHeads()
+	start := 0
+	for i := range heads {
+		hul := heads[i].unitsLen()
+		heads[i].vals = vals[start : start+hul]
+		if grads != nil {
+			heads[i].grads = grads[start : start+hul]
+		}
+		start += hul
+	}
+	return heads
 }
 
 // The Controller interface is implemented by NTM controller networks that wish to operate with memory banks in a NTM.
@@ -117,11 +399,13 @@ type Controller interface {
 	// Wtm1BiasVal returns the values of the bias of the previous weight.
 	// The layout is |-- 1st head weights (size memoryN) --|-- 2nd head --|-- ... --|
 	// The length of the returned slice is numHeads * memoryN.
+	// With multiple memory banks, the weights of the heads of each bank follow those of the previous bank.
 	Wtm1BiasVal() []float64
 	Wtm1BiasGrad() []float64
 
 	// M1mt1BiasVal returns the values of the bias of the memory bank.
 	// The returned matrix is in row major order.
+	// With multiple memory banks, each bank follows the previous one.
 	Mtm1BiasVal() []float64
 	Mtm1BiasGrad() []float64
 
@@ -132,29 +416,47 @@ type Controller interface {
 	// WeightsDesc returns the descriptions of a weight.
 	WeightsDesc(i int) string
 
-	// NumHeads returns the number of memory heads of a controller.
+	// NumHeads returns the number of memory heads of a controller whose initial weights are in the Wtm1 bias.
 	NumHeads() int
-	// MemoryN returns the number of vectors of the memory bank of a controller.
+	// MemoryN returns the number of vectors of the first memory bank of a controller.
 	MemoryN() int
-	// MemoryM returns the size of a vector in the memory bank of a controller.
+	// MemoryM returns the size of a vector in the first memory bank of a controller.
 	MemoryM() int
 }
 
 // A NTM is a neural turing machine as described in A.Graves, G. Wayne, and I. Danihelka. arXiv preprint arXiv:1410.5401, 2014.
 type NTM struct {
 	Controller Controller
-	memOp      *memOp
+	memOp      memoryOp
+}
+
+// A memoryOp is the circuit that operates on the memory bank in a single time step.
+// It is implemented by memOp for the NTM memory, and dncOp for the DNC memory.
+type memoryOp interface {
+	// reads returns the vectors read from memory, which are the inputs of the controller at the next time step.
+	reads() []*memRead
+	// weights returns the addressing weights of the heads.
+	weights() []*refocus
+	// next creates the circuit of the next time step, as directed by heads.
+	next(heads []*Head) memoryOp
+	// truncate returns a circuit with the same memory, weights and reads, which is cut from the circuits at previous
+	// time steps, as in truncated backpropagation through time.
+	truncate() memoryOp
+	// checkpoint is like truncate, except that the gradients on the memory at time t are propagated to the circuits
+	// recomputed from the returned circuit, with the help of setGrads, as in ForwardBackwardCheckpointed.
+	checkpoint() memoryOp
+	// setGrads sets the gradients on the memory, weights and reads of this circuit to those accumulated in ck,
+	// which is a checkpoint of a circuit with the same states.
+	setGrads(ck memoryOp)
+	Backward()
 }
 
 // NewNTM creates a new NTM.
 func NewNTM(old *NTM, x []float64) *NTM {
 	m := NTM{
-		Controller: old.Controller.Forward(old.memOp.R, x),
-	}
-	for i := 0; i < len(m.Controller.Heads()); i++ {
-		m.Controller.Heads()[i].Wtm1 = old.memOp.W[i]
+		Controller: old.Controller.Forward(old.memOp.reads(), x),
 	}
-	m.memOp = newMemOp(m.Controller.Heads(), old.memOp.WM)
+	m.memOp = old.memOp.next(m.Controller.Heads())
 	return &m
 }
 
@@ -163,6 +465,11 @@ func (m *NTM) backward() {
 	m.Controller.Backward()
 }
 
+// truncate returns a NTM with the same states as m, which is cut from the machines at previous time steps.
+func (m *NTM) truncate() *NTM {
+	return &NTM{Controller: truncateController(m.Controller), memOp: m.memOp.truncate()}
+}
+
 // ForwardBackward computes a controller's prediction and gradients with respect to the given ground truth input and output values.
 func ForwardBackward(c Controller, in [][]float64, out DensityModel) []*NTM {
 	weights := c.WeightsGrad()
@@ -171,7 +478,7 @@ func ForwardBackward(c Controller, in [][]float64, out DensityModel) []*NTM {
 	}
 
 	// Set the empty NTM's memory and head weights to their bias values.
-	empty, reads, cas := makeEmptyNTM(c)
+	empty, reads, wtm1s, cas := makeEmptyNTM(c)
 	machines := make([]*NTM, len(in))
 
 	// Backpropagation through time.
@@ -185,11 +492,19 @@ func ForwardBackward(c Controller, in [][]float64, out DensityModel) []*NTM {
 		m.backward()
 	}
 
-	// Compute gradients for the bias values of the initial memory and weights.
-	for i := range reads {
-		reads[i].Backward()
-		for j := range reads[i].W.TopGrad {
-			cas[i].Top[j].Grad += reads[i].W.TopGrad[j]
+	backwardEmptyNTM(c, reads, wtm1s, cas)
+	return machines
+}
+
+// backwardEmptyNTM computes the gradients for the bias values of the initial memory and weights,
+// assuming that the gradients on the initial reads and weights have been set.
+func backwardEmptyNTM(c Controller, reads []*memRead, wtm1s []*refocus, cas []*contentAddressing) {
+	for _, r := range reads {
+		r.Backward()
+	}
+	for i := range cas {
+		for j, g := range wtm1s[i].TopGrad {
+			cas[i].Top[j].Grad += g
 		}
 		cas[i].Backward()
 	}
@@ -198,57 +513,104 @@ func ForwardBackward(c Controller, in [][]float64, out DensityModel) []*NTM {
 	cwtm1 := c.Wtm1BiasGrad()
 	for i := range cas {
 		for j, bs := range cas[i].Units {
-			cwtm1[i*c.MemoryN()+j] = bs.Top.Grad
+			cwtm1[j] = bs.Top.Grad
 		}
+		cwtm1 = cwtm1[len(cas[i].Units):]
 	}
-
-	return machines
 }
 
 // MakeEmptyNTM makes a NTM with its memory and head weights set to their bias values, based on the controller.
 func MakeEmptyNTM(c Controller) *NTM {
-	machine, _, _ := makeEmptyNTM(c)
+	machine, _, _, _ := makeEmptyNTM(c)
 	return machine
 }
 
-func makeEmptyNTM(c Controller) (*NTM, []*memRead, []*contentAddressing) {
+// makeEmptyNTM returns, besides the empty NTM, the initial reads and weights of all heads,
+// as well as the circuits that compute the initial weights from their biases.
+func makeEmptyNTM(c Controller) (*NTM, []*memRead, []*refocus, []*contentAddressing) {
 	cwtm1 := c.Wtm1BiasVal()
-	unws := make([][]*betaSimilarity, c.NumHeads())
+	cmtm1Val := c.Mtm1BiasVal()
+	cmtm1Grad := c.Mtm1BiasGrad()
+	mems := controllerMemories(c)
+	banks := make([]memoryOp, len(mems))
+	numHeads := make([]int, len(mems))
+	var reads []*memRead
+	var wtm1s []*refocus
+	var cas []*contentAddressing
+	for b, mem := range mems {
+		nw := mem.numWeightings() * mem.N
+		nm := mem.N * mem.M
+		op, r, w, ca := makeEmptyMemoryOp(mem, cwtm1[:nw], cmtm1Val[:nm], cmtm1Grad[:nm])
+		cwtm1 = cwtm1[nw:]
+		cmtm1Val = cmtm1Val[nm:]
+		cmtm1Grad = cmtm1Grad[nm:]
+
+		banks[b] = op
+		numHeads[b] = len(mem.emptyHeads())
+		reads = append(reads, r...)
+		wtm1s = append(wtm1s, w...)
+		cas = append(cas, ca...)
+	}
+
+	empty := &NTM{
+		Controller: c,
+		memOp:      banks[0],
+	}
+	if len(banks) > 1 {
+		empty.memOp = newBanksOp(banks, numHeads)
+	}
+
+	return empty, reads, wtm1s, cas
+}
+
+// makeEmptyMemoryOp makes the circuit of a memory bank at time -1 from the biases of its initial weights and memory.
+func makeEmptyMemoryOp(mem MemorySpec, cwtm1, mtm1Val, mtm1Grad []float64) (memoryOp, []*memRead, []*refocus, []*contentAddressing) {
+	unws := make([][]*betaSimilarity, mem.numWeightings())
 	for i := range unws {
-		unws[i] = make([]*betaSimilarity, c.MemoryN())
+		unws[i] = make([]*betaSimilarity, mem.N)
 		for j := range unws[i] {
-			v := cwtm1[i*c.MemoryN()+j]
+			v := cwtm1[i*mem.N+j]
 			unws[i][j] = &betaSimilarity{Top: Unit{Val: v}}
 		}
 	}
 
 	mtm1 := &writtenMemory{
-		N:       c.MemoryN(),
-		TopVal:  c.Mtm1BiasVal(),
-		TopGrad: c.Mtm1BiasGrad(),
+		N:       mem.N,
+		TopVal:  mtm1Val,
+		TopGrad: mtm1Grad,
 	}
 
-	wtm1s := make([]*refocus, c.NumHeads())
-	reads := make([]*memRead, c.NumHeads())
-	cas := make([]*contentAddressing, c.NumHeads())
-	for i := range reads {
+	wtm1s := make([]*refocus, mem.numWeightings())
+	cas := make([]*contentAddressing, mem.numWeightings())
+	for i := range wtm1s {
 		cas[i] = newContentAddressing(unws[i])
 		wtm1s[i] = &refocus{
-			TopVal:  make([]float64, c.MemoryN()),
-			TopGrad: make([]float64, c.MemoryN()),
+			TopVal:  make([]float64, mem.N),
+			TopGrad: make([]float64, mem.N),
 		}
 		for j := range wtm1s[i].TopVal {
 			wtm1s[i].TopVal[j] = cas[i].Top[j].Val
 		}
-		reads[i] = newMemRead(wtm1s[i], mtm1)
+	}
+	// The heads that read come before those that only write.
+	reads := make([]*memRead, mem.numReads())
+	for i := range reads {
+		reads[i] = newMemRead(wtm1s[i], mtm1, mem.KeySize)
 	}
 
-	empty := &NTM{
-		Controller: c,
-		memOp:      &memOp{W: wtm1s, R: reads, WM: mtm1},
+	var op memoryOp = &memOp{W: wtm1s, R: reads, WM: mtm1}
+	if mem.DNC {
+		op = newEmptyDNCOp(wtm1s, reads, mtm1)
+	} else if mem.SparseK > 0 {
+		op = newEmptySparseOp(wtm1s, reads, mtm1, mem.SparseK)
+	} else if mem.LRUA {
+		mop := op.(*memOp)
+		mop.Usage = make([]float64, mem.N)
+		mop.LeastUsed = leastUsed(mop.Usage, mem.numWeightings())
+		mop.Decay = mem.UsageDecay
 	}
 
-	return empty, reads, cas
+	return op, reads, wtm1s, cas
 }
 
 // Predictions returns the predictions of a NTM across time.
@@ -264,12 +626,12 @@ func Predictions(machines []*NTM) [][]float64 {
 // The top level elements represent each head.
 // The second level elements represent every time instant.
 func HeadWeights(machines []*NTM) [][][]float64 {
-	hws := make([][][]float64, len(machines[0].memOp.W))
+	hws := make([][][]float64, len(machines[0].memOp.weights()))
 	for i := range hws {
 		hws[i] = make([][]float64, len(machines))
 		for t, m := range machines {
-			hws[i][t] = make([]float64, len(m.memOp.W[i].TopVal))
-			for j, w := range m.memOp.W[i].TopVal {
+			hws[i][t] = make([]float64, len(m.memOp.weights()[i].TopVal))
+			for j, w := range m.memOp.weights()[i].TopVal {
 				hws[i][t][j] = w
 			}
 		}
@@ -277,58 +639,114 @@ func HeadWeights(machines []*NTM) [][][]float64 {
 	return hws
 }
 
+// BankHeadWeights is like HeadWeights, except that the top level elements represent each memory bank,
+// whose elements are the addressing weights of the heads of the bank.
+func BankHeadWeights(machines []*NTM) [][][][]float64 {
+	hws := HeadWeights(machines)
+	mems := controllerMemories(machines[0].Controller)
+	bhws := make([][][][]float64, len(mems))
+	for b, mem := range mems {
+		n := len(mem.emptyHeads())
+		bhws[b] = hws[:n]
+		hws = hws[n:]
+	}
+	return bhws
+}
+
+// An Optimizer trains the weights of a controller.
+type Optimizer interface {
+	// Train computes the gradients of the weights on the sequence x by calling ForwardBackward, and updates the
+	// weights with them. It returns the machines returned by ForwardBackward.
+	Train(x [][]float64, y DensityModel) []*NTM
+
+	// Update updates the weights with the gradients that are currently stored in the controller.
+	Update()
+}
+
+// SGDMomentumParams are the hyperparameters of SGDMomentum.
+type SGDMomentumParams struct {
+	LearningRate float64
+	Momentum     float64
+}
+
 // SGDMomentum implements stochastic gradient descent with momentum.
 type SGDMomentum struct {
-	C     Controller
-	PrevD []float64
+	C      Controller `json:"-"`
+	Params SGDMomentumParams
+	PrevD  []float64
 }
 
+// NewSGDMomentum creates a SGDMomentum with a learning rate of 1e-4 and a momentum of 0.9.
 func NewSGDMomentum(c Controller) *SGDMomentum {
+	return NewSGDMomentumWithParams(c, SGDMomentumParams{LearningRate: 1e-4, Momentum: 0.9})
+}
+
+func NewSGDMomentumWithParams(c Controller, p SGDMomentumParams) *SGDMomentum {
 	s := SGDMomentum{
-		C:     c,
-		PrevD: make([]float64, len(c.WeightsVal())),
+		C:      c,
+		Params: p,
+		PrevD:  make([]float64, len(c.WeightsVal())),
 	}
 	return &s
 }
 
-func (s *SGDMomentum) Train(x [][]float64, y DensityModel, alpha, mt float64) []*NTM {
+func (s *SGDMomentum) Train(x [][]float64, y DensityModel) []*NTM {
 	machines := ForwardBackward(s.C, x, y)
+	s.Update()
+	return machines
+}
 
+func (s *SGDMomentum) Update() {
 	weights := s.C.WeightsVal()
 	for i, grad := range s.C.WeightsGrad() {
-		d := -alpha*grad + mt*s.PrevD[i]
+		d := -s.Params.LearningRate*grad + s.Params.Momentum*s.PrevD[i]
 		weights[i] += d
 		s.PrevD[i] = d
 	}
-	return machines
+}
+
+// RMSPropParams are the hyperparameters of RMSProp, which are named after the roles they play in the updating equations.
+type RMSPropParams struct {
+	Decay        float64 // the decay of the moving averages of the gradients and their squares
+	Momentum     float64
+	LearningRate float64
+	Epsilon      float64
 }
 
 // RMSProp implements the rmsprop algorithm. The detailed updating equations are given in
 // Graves, Alex (2013). Generating sequences with recurrent neural networks. arXiv preprint arXiv:1308.0850.
 type RMSProp struct {
-	C Controller
-	N []float64
-	G []float64
-	D []float64
+	C      Controller `json:"-"`
+	Params RMSPropParams
+	N      []float64
+	G      []float64
+	D      []float64
 }
 
+// NewRMSProp creates a RMSProp with a decay of 0.95, a momentum of 0.5, a learning rate of 1e-3 and an epsilon of 1e-3.
 func NewRMSProp(c Controller) *RMSProp {
+	return NewRMSPropWithParams(c, RMSPropParams{Decay: 0.95, Momentum: 0.5, LearningRate: 1e-3, Epsilon: 1e-3})
+}
+
+func NewRMSPropWithParams(c Controller, p RMSPropParams) *RMSProp {
 	r := RMSProp{
-		C: c,
-		N: make([]float64, len(c.WeightsVal())),
-		G: make([]float64, len(c.WeightsVal())),
-		D: make([]float64, len(c.WeightsVal())),
+		C:      c,
+		Params: p,
+		N:      make([]float64, len(c.WeightsVal())),
+		G:      make([]float64, len(c.WeightsVal())),
+		D:      make([]float64, len(c.WeightsVal())),
 	}
 	return &r
 }
 
-func (r *RMSProp) Train(x [][]float64, y DensityModel, a, b, c, d float64) []*NTM {
+func (r *RMSProp) Train(x [][]float64, y DensityModel) []*NTM {
 	machines := ForwardBackward(r.C, x, y)
-	r.update(a, b, c, d)
+	r.Update()
 	return machines
 }
 
-func (r *RMSProp) update(a, b, c, d float64) {
+func (r *RMSProp) Update() {
+	a, b, c, d := r.Params.Decay, r.Params.Momentum, r.Params.LearningRate, r.Params.Epsilon
 	grad := blas64.Vector{Inc: 1, Data: r.C.WeightsGrad()}
 	grad2 := blas64.Vector{Inc: 1, Data: make([]float64, len(grad.Data))}
 	for i, w := range grad.Data {
@@ -360,6 +778,10 @@ type DensityModel interface {
 	// Model sets the value and gradient of Units of the output layer.
 	Model(t int, yHVal []float64, yHGrad []float64)
 
+	// Transform transforms the values of the output layer into the final output in place, as Model does,
+	// without requiring the ground truth.
+	Transform(yHVal []float64)
+
 	// Loss is the loss definition of this model.
 	Loss(output [][]float64) float64
 }
@@ -372,11 +794,17 @@ type LogisticModel struct {
 
 // Model sets the values and gradients of the output units.
 func (m *LogisticModel) Model(t int, yHVal []float64, yHGrad []float64) {
+	m.Transform(yHVal)
 	ys := m.Y[t]
 	for i, yhv := range yHVal {
-		newYhv := Sigmoid(yhv)
-		yHVal[i] = newYhv
-		yHGrad[i] = newYhv - ys[i]
+		yHGrad[i] = yhv - ys[i]
+	}
+}
+
+// Transform applies the logistic sigmoid to the output units.
+func (m *LogisticModel) Transform(yHVal []float64) {
+	for i, yhv := range yHVal {
+		yHVal[i] = Sigmoid(yhv)
 	}
 }
 
@@ -401,18 +829,23 @@ type MultinomialModel struct {
 
 // Model sets the values and gradients of the output units.
 func (m *MultinomialModel) Model(t int, yHVal []float64, yHGrad []float64) {
+	m.Transform(yHVal)
+	k := m.Y[t]
+	for i, yhv := range yHVal {
+		yHGrad[i] = yhv - delta(i, k)
+	}
+}
+
+// Transform applies the softmax function to the output units.
+func (m *MultinomialModel) Transform(yHVal []float64) {
 	var sum float64 = 0
 	for i, yhv := range yHVal {
 		v := math.Exp(yhv)
 		yHVal[i] = v
 		sum += v
 	}
-
-	k := m.Y[t]
 	for i, yhv := range yHVal {
-		newYhv := yhv / sum
-		yHVal[i] = newYhv
-		yHGrad[i] = newYhv - delta(i, k)
+		yHVal[i] = yhv / sum
 	}
 }
 
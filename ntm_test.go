@@ -33,7 +33,8 @@ func TestRMSProp(t *testing.T) {
 	rms.G[len(c.WeightsVal())-1] = 0.8
 	rms.D[len(c.WeightsVal())-1] = 8.1
 
-	rms.update(0.95, 0.9, 0.0001, 0.0001)
+	rms.Params = RMSPropParams{Decay: 0.95, Momentum: 0.9, LearningRate: 0.0001, Epsilon: 0.0001}
+	rms.Update()
 
 	checkRMS(t, c, rms, 0, 10.1495, 1.845, 3.329896, 4.429896)
 	checkRMS(t, c, rms, 1, 13.7655, 2.09, 1.529938, 2.729938)
@@ -0,0 +1,171 @@
+package ntm
+
+import (
+	"math"
+)
+
+// AdamParams are the hyperparameters of Adam.
+// Typical values are a learning rate of 1e-3, a Beta1 of 0.9, a Beta2 of 0.999 and an epsilon of 1e-8.
+type AdamParams struct {
+	LearningRate float64
+	Beta1        float64 // the decay of the moving average of the gradients
+	Beta2        float64 // the decay of the moving average of the squared gradients
+	Epsilon      float64
+}
+
+// Adam implements the Adam algorithm in
+// Kingma, D. P., & Ba, J. (2014). Adam: A method for stochastic optimization. arXiv preprint arXiv:1412.6980.
+type Adam struct {
+	C      Controller `json:"-"`
+	Params AdamParams
+	M      []float64 // the moving average of the gradients
+	V      []float64 // the moving average of the squared gradients
+	T      int       // the number of updates so far
+}
+
+func NewAdam(c Controller, p AdamParams) *Adam {
+	a := Adam{
+		C:      c,
+		Params: p,
+		M:      make([]float64, len(c.WeightsVal())),
+		V:      make([]float64, len(c.WeightsVal())),
+	}
+	return &a
+}
+
+func (a *Adam) Train(x [][]float64, y DensityModel) []*NTM {
+	machines := ForwardBackward(a.C, x, y)
+	a.Update()
+	return machines
+}
+
+func (a *Adam) Update() {
+	a.update(0)
+}
+
+// update updates the weights, which are decayed by weightDecay in addition to the Adam step as in AdamW.
+func (a *Adam) update(weightDecay float64) {
+	p := a.Params
+	a.T++
+	c1 := 1 - math.Pow(p.Beta1, float64(a.T))
+	c2 := 1 - math.Pow(p.Beta2, float64(a.T))
+	weights := a.C.WeightsVal()
+	for i, g := range a.C.WeightsGrad() {
+		a.M[i] = p.Beta1*a.M[i] + (1-p.Beta1)*g
+		a.V[i] = p.Beta2*a.V[i] + (1-p.Beta2)*g*g
+		mHat := a.M[i] / c1
+		vHat := a.V[i] / c2
+		weights[i] -= p.LearningRate * (mHat/(math.Sqrt(vHat)+p.Epsilon) + weightDecay*weights[i])
+	}
+}
+
+// AdamWParams are the hyperparameters of AdamW.
+type AdamWParams struct {
+	AdamParams
+	WeightDecay float64
+}
+
+// AdamW implements Adam with decoupled weight decay in
+// Loshchilov, I., & Hutter, F. (2017). Decoupled weight decay regularization. arXiv preprint arXiv:1711.05101.
+// Unlike adding an L2 penalty to the loss, the weight decay is not scaled by the moving averages of the gradients.
+type AdamW struct {
+	Adam
+	WeightDecay float64
+}
+
+func NewAdamW(c Controller, p AdamWParams) *AdamW {
+	a := AdamW{
+		Adam:        *NewAdam(c, p.AdamParams),
+		WeightDecay: p.WeightDecay,
+	}
+	return &a
+}
+
+func (a *AdamW) Train(x [][]float64, y DensityModel) []*NTM {
+	machines := ForwardBackward(a.C, x, y)
+	a.Update()
+	return machines
+}
+
+func (a *AdamW) Update() {
+	a.update(a.WeightDecay)
+}
+
+// AdagradParams are the hyperparameters of Adagrad.
+type AdagradParams struct {
+	LearningRate float64
+	Epsilon      float64
+}
+
+// Adagrad implements the Adagrad algorithm in
+// Duchi, J., Hazan, E., & Singer, Y. (2011). Adaptive subgradient methods for online learning and stochastic optimization. Journal of Machine Learning Research, 12, 2121-2159.
+type Adagrad struct {
+	C      Controller `json:"-"`
+	Params AdagradParams
+	G      []float64 // the sum of the squared gradients
+}
+
+func NewAdagrad(c Controller, p AdagradParams) *Adagrad {
+	a := Adagrad{
+		C:      c,
+		Params: p,
+		G:      make([]float64, len(c.WeightsVal())),
+	}
+	return &a
+}
+
+func (a *Adagrad) Train(x [][]float64, y DensityModel) []*NTM {
+	machines := ForwardBackward(a.C, x, y)
+	a.Update()
+	return machines
+}
+
+func (a *Adagrad) Update() {
+	weights := a.C.WeightsVal()
+	for i, g := range a.C.WeightsGrad() {
+		a.G[i] += g * g
+		weights[i] -= a.Params.LearningRate * g / (math.Sqrt(a.G[i]) + a.Params.Epsilon)
+	}
+}
+
+// AdadeltaParams are the hyperparameters of Adadelta.
+type AdadeltaParams struct {
+	Rho     float64 // the decay of the moving averages
+	Epsilon float64
+}
+
+// Adadelta implements the Adadelta algorithm in
+// Zeiler, M. D. (2012). ADADELTA: an adaptive learning rate method. arXiv preprint arXiv:1212.5701.
+type Adadelta struct {
+	C      Controller `json:"-"`
+	Params AdadeltaParams
+	G      []float64 // the moving average of the squared gradients
+	D      []float64 // the moving average of the squared updates
+}
+
+func NewAdadelta(c Controller, p AdadeltaParams) *Adadelta {
+	a := Adadelta{
+		C:      c,
+		Params: p,
+		G:      make([]float64, len(c.WeightsVal())),
+		D:      make([]float64, len(c.WeightsVal())),
+	}
+	return &a
+}
+
+func (a *Adadelta) Train(x [][]float64, y DensityModel) []*NTM {
+	machines := ForwardBackward(a.C, x, y)
+	a.Update()
+	return machines
+}
+
+func (a *Adadelta) Update() {
+	rho, eps := a.Params.Rho, a.Params.Epsilon
+	weights := a.C.WeightsVal()
+	for i, g := range a.C.WeightsGrad() {
+		a.G[i] = rho*a.G[i] + (1-rho)*g*g
+		d := -math.Sqrt(a.D[i]+eps) / math.Sqrt(a.G[i]+eps) * g
+		a.D[i] = rho*a.D[i] + (1-rho)*d*d
+		weights[i] += d
+	}
+}
@@ -0,0 +1,142 @@
+package ntm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAdam(t *testing.T) {
+	c := NewEmptyController1(1, 1, 1, 1, 1, 1)
+	adam := NewAdam(c, AdamParams{LearningRate: 0.01, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8})
+	last := len(c.WeightsVal()) - 1
+
+	c.WeightsVal()[0] = 1.1
+	c.WeightsGrad()[0] = 2.7
+	adam.M[0] = 0.4
+	adam.V[0] = 3.1
+
+	c.WeightsVal()[last] = 0.9
+	c.WeightsGrad()[last] = -1.3
+	adam.M[last] = -0.2
+	adam.V[last] = 1.5
+
+	adam.T = 2
+	adam.Update()
+
+	checkOptimizer(t, "M", 0, adam.M[0], 0.63)
+	checkOptimizer(t, "V", 0, adam.V[0], 3.10419)
+	checkOptimizer(t, "w", 0, c.WeightsVal()[0], 1.099277662)
+	checkOptimizer(t, "M", last, adam.M[last], -0.31)
+	checkOptimizer(t, "V", last, adam.V[last], 1.50019)
+	checkOptimizer(t, "w", last, c.WeightsVal()[last], 0.900511285)
+	if adam.T != 3 {
+		t.Errorf("adam.T(%d) != 3", adam.T)
+	}
+}
+
+func TestAdamW(t *testing.T) {
+	c := NewEmptyController1(1, 1, 1, 1, 1, 1)
+	adam := NewAdamW(c, AdamWParams{
+		AdamParams:  AdamParams{LearningRate: 0.01, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8},
+		WeightDecay: 0.1,
+	})
+
+	c.WeightsVal()[0] = 1.1
+	c.WeightsGrad()[0] = 2.7
+	adam.M[0] = 0.4
+	adam.V[0] = 3.1
+
+	adam.T = 2
+	adam.Update()
+
+	checkOptimizer(t, "M", 0, adam.M[0], 0.63)
+	checkOptimizer(t, "V", 0, adam.V[0], 3.10419)
+	checkOptimizer(t, "w", 0, c.WeightsVal()[0], 1.098177662)
+}
+
+func TestAdagrad(t *testing.T) {
+	c := NewEmptyController1(1, 1, 1, 1, 1, 1)
+	ada := NewAdagrad(c, AdagradParams{LearningRate: 0.1, Epsilon: 1e-8})
+	last := len(c.WeightsVal()) - 1
+
+	c.WeightsVal()[0] = 1.1
+	c.WeightsGrad()[0] = 2.7
+	ada.G[0] = 10.3
+
+	c.WeightsVal()[last] = 0.9
+	c.WeightsGrad()[last] = -1.3
+	ada.G[last] = 4.2
+
+	ada.Update()
+
+	checkOptimizer(t, "G", 0, ada.G[0], 17.59)
+	checkOptimizer(t, "w", 0, c.WeightsVal()[0], 1.035622984)
+	checkOptimizer(t, "G", last, ada.G[last], 5.89)
+	checkOptimizer(t, "w", last, c.WeightsVal()[last], 0.953565567)
+}
+
+func TestAdadelta(t *testing.T) {
+	c := NewEmptyController1(1, 1, 1, 1, 1, 1)
+	ada := NewAdadelta(c, AdadeltaParams{Rho: 0.95, Epsilon: 1e-6})
+	last := len(c.WeightsVal()) - 1
+
+	c.WeightsVal()[0] = 1.1
+	c.WeightsGrad()[0] = 2.7
+	ada.G[0] = 10.3
+	ada.D[0] = 0.5
+
+	c.WeightsVal()[last] = 0.9
+	c.WeightsGrad()[last] = -1.3
+	ada.G[last] = 4.2
+	ada.D[last] = 0.2
+
+	ada.Update()
+
+	checkOptimizer(t, "G", 0, ada.G[0], 10.1495)
+	checkOptimizer(t, "D", 0, ada.D[0], 0.492956584)
+	checkOptimizer(t, "w", 0, c.WeightsVal()[0], 0.500724041)
+	checkOptimizer(t, "G", last, ada.G[last], 4.0745)
+	checkOptimizer(t, "D", last, ada.D[last], 0.194147768)
+	checkOptimizer(t, "w", last, c.WeightsVal()[last], 1.188019718)
+}
+
+// TestOptimizers checks that every optimizer decreases the loss of a small problem.
+func TestOptimizers(t *testing.T) {
+	x := [][]float64{{0.1, 0.9}, {0.8, 0.3}, {0.5, 0.5}, {0.2, 0.6}}
+	model := &LogisticModel{Y: [][]float64{{1, 0}, {0, 1}, {1, 1}, {0, 0}}}
+	newOptimizers := map[string]func(Controller) Optimizer{
+		"SGDMomentum": func(c Controller) Optimizer {
+			return NewSGDMomentumWithParams(c, SGDMomentumParams{LearningRate: 1e-2, Momentum: 0.9})
+		},
+		"RMSProp": func(c Controller) Optimizer { return NewRMSProp(c) },
+		"Adam": func(c Controller) Optimizer {
+			return NewAdam(c, AdamParams{LearningRate: 1e-2, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8})
+		},
+		"Adagrad":  func(c Controller) Optimizer { return NewAdagrad(c, AdagradParams{LearningRate: 1e-1, Epsilon: 1e-8}) },
+		"Adadelta": func(c Controller) Optimizer { return NewAdadelta(c, AdadeltaParams{Rho: 0.9, Epsilon: 1e-3}) },
+		"AdamW": func(c Controller) Optimizer {
+			return NewAdamW(c, AdamWParams{AdamParams: AdamParams{LearningRate: 1e-2, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}, WeightDecay: 1e-2})
+		},
+	}
+	for name, newOptimizer := range newOptimizers {
+		c := NewEmptyController1(2, 2, 3, 1, 4, 2)
+		for i := range c.WeightsVal() {
+			c.WeightsVal()[i] = 0.1 * math.Sin(float64(i))
+		}
+		opt := newOptimizer(c)
+		first := model.Loss(Predictions(opt.Train(x, model)))
+		for i := 0; i < 50; i++ {
+			opt.Train(x, model)
+		}
+		if last := model.Loss(Predictions(ForwardBackward(c, x, model))); last >= first {
+			t.Errorf("%s: loss %f did not decrease from %f", name, last, first)
+		}
+	}
+}
+
+func checkOptimizer(t *testing.T, name string, i int, got, expected float64) {
+	tol := 1e-6
+	if math.Abs(got-expected) > tol {
+		t.Errorf("%s[%d](%g) != %g", name, i, got, expected)
+	}
+}
@@ -22,6 +22,10 @@ type Generator struct {
 	Dataset     Dataset
 	IndexToChar map[int]string
 
+	// MaxLines limits the number of lines of a poem generated by GenSeq if positive.
+	// Without truncated backpropagation through time, poems with lines over 200 might need over 10GB of RAM.
+	MaxLines int
+
 	indices []int
 	offset  int
 }
@@ -32,7 +36,7 @@ func NewGenerator(filepath string) (*Generator, error) {
 		return nil, err
 	}
 	defer f.Close()
-	g := Generator{IndexToChar: make(map[int]string)}
+	g := Generator{IndexToChar: make(map[int]string), MaxLines: 32}
 	if err := json.NewDecoder(f).Decode(&g.Dataset); err != nil {
 		return nil, err
 	}
@@ -41,12 +45,15 @@ func NewGenerator(filepath string) (*Generator, error) {
 		g.IndexToChar[i] = s
 	}
 
-	g.indices = make([]int, len(g.Dataset.Shis))
-	g.resample()
 	return &g, nil
 }
 
 func (g *Generator) GenSeq() ([][]float64, []int) {
+	// The poems are first shuffled here instead of in NewGenerator, so that training programs which seed the random
+	// number generator after creating a Generator draw the same poems when resuming from a checkpoint.
+	if g.indices == nil {
+		g.resample()
+	}
 	poem := g.Dataset.Shis[g.indices[g.offset]]
 	g.offset += 1
 	if g.offset == len(g.indices) {
@@ -54,9 +61,8 @@ func (g *Generator) GenSeq() ([][]float64, []int) {
 	}
 
 	// Limit poem size to avoid memory issues.
-	// For poems with lines over 200, we might need over 10GB of RAM.
-	if len(poem) > 32 {
-		poem = poem[0:32]
+	if g.MaxLines > 0 && len(poem) > g.MaxLines {
+		poem = poem[0:g.MaxLines]
 	}
 
 	inputSize := g.InputSize()
@@ -124,7 +130,7 @@ func (g *Generator) OutputSize() int {
 }
 
 func (g *Generator) resample() {
-	g.indices = rand.Perm(len(g.indices))
+	g.indices = rand.Perm(len(g.Dataset.Shis))
 	g.offset = 0
 }
 
@@ -0,0 +1,49 @@
+package poem
+
+import (
+	"fmt"
+
+	"ntm"
+	"ntm/task"
+)
+
+func init() {
+	task.Register("poem", func(data string) (task.Task, error) {
+		if data == "" {
+			return nil, fmt.Errorf("the poem task needs a dataset such as poem/data/quantangshi3000.int")
+		}
+		g, err := NewGenerator(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Task{Generator: g}, nil
+	})
+}
+
+// Task is the task of generating poems as a task.Task, in which the NTM is given a character of each line in the
+// first half of a sequence, and is expected to write the poem in the second half.
+type Task struct {
+	*Generator
+}
+
+func (t *Task) Sample() task.Seq {
+	x, y := t.GenSeq()
+	oneHot := make([][]float64, len(y))
+	for i, c := range y {
+		oneHot[i] = make([]float64, t.OutputSize())
+		oneHot[i][c] = 1
+	}
+	return task.Seq{X: x, Y: oneHot, Model: &ntm.MultinomialModel{Y: y}}
+}
+
+// Loss returns the loss in nats per character of the poem written in the second half of seq.
+func (t *Task) Loss(seq task.Seq, predictions [][]float64) float64 {
+	y := seq.Model.(*ntm.MultinomialModel).Y
+	numChar := len(y) / 2
+	l := (&ntm.MultinomialModel{Y: y[numChar+1:]}).Loss(predictions[numChar+1:])
+	return l / float64(numChar)
+}
+
+func (t *Task) Evals() []task.Eval {
+	return []task.Eval{{Name: "poem", Sample: t.Sample}}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"log"
 	"math/rand"
@@ -12,7 +11,7 @@ import (
 )
 
 var (
-	weightsFile = flag.String("weightsFile", "", "trained weights in JSON")
+	weightsFile = flag.String("weightsFile", "", "a checkpoint or trained weights in JSON")
 )
 
 func main() {
@@ -25,8 +24,20 @@ func main() {
 	numHeads := 8
 	n := 128
 	m := 32
-	c := ntm.NewEmptyController1(gen.InputSize(), gen.OutputSize(), h1Size, numHeads, n, m)
-	assignWeights(c)
+	spec := ntm.ControllerSpec{Type: ntm.Controller1Type, XSize: gen.InputSize(), YSize: gen.OutputSize(), HSize: h1Size, Memories: []ntm.MemorySpec{{N: n, M: m, NumHeads: numHeads}}}
+	if *weightsFile == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	ck, err := ntm.LoadCheckpoint(*weightsFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	// Bare arrays of weights dumped before checkpoints existed are of the controller described by spec.
+	c, err := ck.NewControllerWithDefault(spec)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	p := [][]string{
 		{"红", "", "", "", ""},
@@ -141,7 +152,7 @@ func showPrediction(pred [][]float64, gen *poem.Generator, oripoem [][]string) {
 }
 
 func predict(c ntm.Controller, shi [][]string, gen *poem.Generator) [][]float64 {
-	machine := ntm.MakeEmptyNTM(c)
+	runner := ntm.NewRunner(c, &ntm.MultinomialModel{})
 
 	// Feed the poem constraints into the NTM.
 	numChar := 0
@@ -150,17 +161,17 @@ func predict(c ntm.Controller, shi [][]string, gen *poem.Generator) [][]float64
 		for _, s := range line {
 			numChar += 1
 			input := vecFromString(s, gen)
-			machine, output = forward(machine, input, output)
+			output = append(output, runner.Step(input))
 		}
 		numChar += 1
 		input := gen.Linefeed()
-		machine, output = forward(machine, input, output)
+		output = append(output, runner.Step(input))
 	}
 	input := gen.EndOfPoem()
-	machine, output = forward(machine, input, output)
+	output = append(output, runner.Step(input))
 
 	input = make([]float64, gen.InputSize())
-	machine, output = forward(machine, input, output)
+	output = append(output, runner.Step(input))
 
 	// Follow the predictions of the NTM.
 	i := 1
@@ -171,7 +182,7 @@ func predict(c ntm.Controller, shi [][]string, gen *poem.Generator) [][]float64
 			} else {
 				input, _ = sample(output[len(output)-1], gen)
 			}
-			machine, output = forward(machine, input, output)
+			output = append(output, runner.Step(input))
 			i++
 		}
 
@@ -179,7 +190,7 @@ func predict(c ntm.Controller, shi [][]string, gen *poem.Generator) [][]float64
 			break
 		}
 		input, _ = sample(output[len(output)-1], gen)
-		machine, output = forward(machine, input, output)
+		output = append(output, runner.Step(input))
 		i++
 	}
 
@@ -212,31 +223,3 @@ func vecFromString(s string, g *poem.Generator) []float64 {
 	v[c] = 1
 	return v
 }
-
-func forward(machine *ntm.NTM, input []float64, output [][]float64) (*ntm.NTM, [][]float64) {
-	newMachine := ntm.NewNTM(machine, input)
-
-	// Compute the multinomial output by faking a dummy model.
-	model := &ntm.MultinomialModel{Y: []int{0}}
-	model.Model(0, newMachine.Controller.YVal(), newMachine.Controller.YGrad())
-
-	output = append(output, newMachine.Controller.YVal())
-	return newMachine, output
-}
-
-func assignWeights(c ntm.Controller) {
-	if *weightsFile == "" {
-		flag.PrintDefaults()
-		os.Exit(1)
-	}
-
-	f, err := os.Open(*weightsFile)
-	if err != nil {
-		log.Fatalf("%v", err)
-	}
-	defer f.Close()
-	ws := c.WeightsVal()
-	if err := json.NewDecoder(f).Decode(&ws); err != nil {
-		log.Fatalf("%v", err)
-	}
-}
@@ -0,0 +1,81 @@
+package prioritysort
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// GenSeq generates a sequence of the priority sort task in the paper, in which the NTM is presented numItems random
+// binary vectors of size vectorSize, each of which is tagged with a priority drawn uniformly from [-1, 1].
+// The NTM is then expected to output the k vectors of the highest priorities, sorted from the highest priority to
+// the lowest.
+//
+// The channel vectorSize of the input holds the priority of each vector, and the channel vectorSize+1 is set on the
+// time step after the last vector. The output is 0 except for the last k time steps, in which the sorted vectors
+// are expected.
+//
+// GenSeq panics if k exceeds numItems.
+func GenSeq(numItems, k, vectorSize int) ([][]float64, [][]float64) {
+	if k > numItems {
+		panic(fmt.Sprintf("cannot sort %d of %d items", k, numItems))
+	}
+	data := make([][]float64, numItems)
+	priorities := make([]float64, numItems)
+	for i := range data {
+		data[i] = make([]float64, vectorSize)
+		for j := range data[i] {
+			data[i][j] = float64(rand.Intn(2))
+		}
+		priorities[i] = 2*rand.Float64() - 1
+	}
+
+	input := make([][]float64, 0, numItems+1+k)
+	for i, datum := range data {
+		v := make([]float64, vectorSize+2)
+		copy(v, datum)
+		v[vectorSize] = priorities[i]
+		input = append(input, v)
+	}
+	marker := make([]float64, vectorSize+2)
+	marker[vectorSize+1] = 1
+	input = append(input, marker)
+
+	output := make([][]float64, len(input))
+	for i := range output {
+		output[i] = make([]float64, vectorSize)
+	}
+	order := make([]int, numItems)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return priorities[order[a]] > priorities[order[b]] })
+	for _, i := range order[:k] {
+		input = append(input, make([]float64, vectorSize+2))
+		v := make([]float64, vectorSize)
+		copy(v, data[i])
+		output = append(output, v)
+	}
+
+	return input, output
+}
+
+// BitError returns the fraction of the bits of the k sorted vectors at the end of y that are wrong in predictions,
+// in which a prediction is taken as 1 if it is above 0.5 and 0 otherwise.
+func BitError(y, predictions [][]float64, k int) float64 {
+	wrong := 0
+	total := 0
+	for t := len(y) - k; t < len(y); t++ {
+		for i, b := range y[t] {
+			p := 0.0
+			if predictions[t][i] > 0.5 {
+				p = 1
+			}
+			if p != b {
+				wrong++
+			}
+			total++
+		}
+	}
+	return float64(wrong) / float64(total)
+}
@@ -0,0 +1,71 @@
+package prioritysort
+
+import (
+	"fmt"
+
+	"ntm"
+	"ntm/task"
+)
+
+func init() {
+	task.Register("prioritysort", func(string) (task.Task, error) {
+		return &Task{NumItems: 20, K: 16, VectorSize: 8}, nil
+	})
+}
+
+// Task is the priority sort task as a task.Task, in which NTMs are trained on sorting the K vectors of the highest
+// priorities among NumItems vectors of VectorSize bits.
+type Task struct {
+	NumItems   int
+	K          int
+	VectorSize int
+}
+
+func (t *Task) InputSize() int {
+	return t.VectorSize + 2
+}
+
+func (t *Task) OutputSize() int {
+	return t.VectorSize
+}
+
+func (t *Task) Sample() task.Seq {
+	return t.seq(t.NumItems, t.K)
+}
+
+func (t *Task) seq(numItems, k int) task.Seq {
+	x, y := GenSeq(numItems, k, t.VectorSize)
+	return task.Seq{X: x, Y: y, Model: &ntm.LogisticModel{Y: y}}
+}
+
+// Loss returns the loss in nats per bit of the sorted vectors.
+func (t *Task) Loss(seq task.Seq, predictions [][]float64) float64 {
+	return seq.Model.Loss(predictions) / float64(t.sorted(seq)*t.VectorSize)
+}
+
+// Report reports the per-bit error of the sorted vectors.
+func (t *Task) Report(seq task.Seq, predictions [][]float64) string {
+	return fmt.Sprintf("bit error: %f", BitError(seq.Y, predictions, t.sorted(seq)))
+}
+
+// sorted returns the number of sorted vectors in seq, which are the time steps after the delimiter.
+func (t *Task) sorted(seq task.Seq) int {
+	for i, v := range seq.X {
+		if v[t.VectorSize+1] == 1 {
+			return len(seq.X) - i - 1
+		}
+	}
+	return 0
+}
+
+func (t *Task) Evals() []task.Eval {
+	confs := []struct{ numItems, k int }{{20, 16}, {10, 8}, {30, 24}}
+	evals := make([]task.Eval, 0, len(confs))
+	for _, conf := range confs {
+		evals = append(evals, task.Eval{
+			Name:   fmt.Sprintf("%d items, %d sorted", conf.numItems, conf.k),
+			Sample: func() task.Seq { return t.seq(conf.numItems, conf.k) },
+		})
+	}
+	return evals
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"ntm"
+	"ntm/prioritysort"
+	"ntm/tester"
+)
+
+var weightsFile = flag.String("weightsFile", "", "a checkpoint or trained weights in JSON")
+
+func main() {
+	flag.Parse()
+	if *weightsFile == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	t := &prioritysort.Task{NumItems: 20, K: 16, VectorSize: 8}
+	spec := ntm.ControllerSpec{Type: ntm.Controller1Type, XSize: t.InputSize(), YSize: t.OutputSize(), HSize: 100, Memories: []ntm.MemorySpec{{N: 128, M: 20, NumHeads: 2}}}
+	ck, err := ntm.LoadCheckpoint(*weightsFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if ck.Task != "" && ck.Task != "prioritysort" {
+		log.Fatalf("%s is a checkpoint of task %q, not %q", *weightsFile, ck.Task, "prioritysort")
+	}
+	// Bare arrays of weights are of the controller trained by prioritysort/train.
+	c, err := ck.NewControllerWithDefault(spec)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if err := tester.Serve(":9000", tester.Evaluate(t, c)); err != nil {
+		log.Printf("%v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+
+	"ntm"
+	"ntm/prioritysort"
+	"ntm/trainer"
+)
+
+func main() {
+	flag.Parse()
+
+	// As in the paper, the NTM sorts 20 vectors of 8 bits, and outputs the 16 of the highest priorities.
+	t := &prioritysort.Task{NumItems: 20, K: 16, VectorSize: 8}
+	trainer.Run(t, trainer.Config{
+		Task: "prioritysort",
+		Spec: ntm.ControllerSpec{
+			Type:     ntm.Controller1Type,
+			XSize:    t.InputSize(),
+			YSize:    t.OutputSize(),
+			HSize:    100,
+			Memories: []ntm.MemorySpec{{N: 128, M: 20, NumHeads: 2}},
+		},
+		Seed: 2,
+		Port: 8091,
+	})
+}
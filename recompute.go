@@ -0,0 +1,94 @@
+package ntm
+
+import (
+	"fmt"
+	"math"
+)
+
+// ForwardBackwardCheckpointed is like ForwardBackward, except that it keeps only the states of every k-th time step
+// during the forward pass, and recomputes the machines between them during the backward pass.
+// The gradients are identical to those of ForwardBackward, whereas the memory needed is proportional to T/k + k
+// instead of the sequence length T, at the cost of running the forward pass twice.
+// If k is not positive, it is set to the square root of T, which minimizes the memory needed.
+// Since the machines are not kept alive, the predictions at each time step are returned instead.
+// c must be one of the controllers of this package, which implement truncation and recomputation.
+func ForwardBackwardCheckpointed(c Controller, in [][]float64, out DensityModel, k int) [][]float64 {
+	if k <= 0 {
+		k = int(math.Ceil(math.Sqrt(float64(len(in)))))
+	}
+	weights := c.WeightsGrad()
+	for i := range weights {
+		weights[i] = 0
+	}
+
+	// Forward pass, in which the state before each segment of k time steps is checkpointed.
+	empty, reads, wtm1s, cas := makeEmptyNTM(c)
+	checkpoints := make([]*NTM, 0, len(in)/k+1)
+	m := empty
+	for t := range in {
+		if t%k == 0 {
+			checkpoints = append(checkpoints, m.checkpoint())
+		}
+		m = NewNTM(m, in[t])
+	}
+
+	// Backward pass, in which each segment is recomputed from its checkpoint.
+	// The gradients on the checkpoint of a segment are those on the last machine of the previous segment.
+	predictions := make([][]float64, len(in))
+	for s := len(checkpoints) - 1; s >= 0; s-- {
+		start := s * k
+		end := start + k
+		if end > len(in) {
+			end = len(in)
+		}
+		machines := make([]*NTM, end-start)
+		m := checkpoints[s]
+		for t := start; t < end; t++ {
+			m = NewNTM(m, in[t])
+			machines[t-start] = m
+		}
+		if s+1 < len(checkpoints) {
+			m.setGrads(checkpoints[s+1])
+		}
+		for t := end - 1; t >= start; t-- {
+			m := machines[t-start]
+			out.Model(t, m.Controller.YVal(), m.Controller.YGrad())
+			m.backward()
+			predictions[t] = m.Controller.YVal()
+		}
+	}
+	empty.setGrads(checkpoints[0])
+
+	backwardEmptyNTM(c, reads, wtm1s, cas)
+	return predictions
+}
+
+// TrainCheckpointed computes the gradients of a sequence with ForwardBackwardCheckpointed, and updates the weights
+// of c with opt, which must be an Optimizer of c. It returns the predictions at each time step.
+func TrainCheckpointed(opt Optimizer, c Controller, in [][]float64, out DensityModel, k int) [][]float64 {
+	predictions := ForwardBackwardCheckpointed(c, in, out, k)
+	opt.Update()
+	return predictions
+}
+
+// checkpoint returns a NTM with the same states as m, from which the machines after m can be recomputed.
+func (m *NTM) checkpoint() *NTM {
+	return &NTM{Controller: truncateController(m.Controller), memOp: m.memOp.checkpoint()}
+}
+
+// setGrads sets the gradients on the states of m to those accumulated in ck, which is a checkpoint of m.
+func (m *NTM) setGrads(ck *NTM) {
+	g, ok := m.Controller.(gradSetter)
+	if !ok {
+		panic(fmt.Sprintf("controller %T cannot be recomputed from checkpoints", m.Controller))
+	}
+	g.setGrads(ck.Controller)
+	m.memOp.setGrads(ck.memOp)
+}
+
+// A gradSetter is a Controller that can be recomputed from its checkpoints, as in ForwardBackwardCheckpointed.
+type gradSetter interface {
+	// setGrads sets the gradients on the states of this Controller to those accumulated in ck,
+	// which is a Controller truncated from a Controller with the same states.
+	setGrads(ck Controller)
+}
@@ -0,0 +1,56 @@
+package ntm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestForwardBackwardCheckpointed(t *testing.T) {
+	controllers := map[string]Controller{
+		"controller1": NewEmptyController1(3, 2, 4, 2, 5, 3),
+		"feedforward": NewEmptyFeedforwardControllerWithMemory(3, 2, []Layer{{Size: 4, Activation: TanhActivation}},
+			MemorySpec{N: 4, M: 3, NumHeads: 1, KeySize: 1}),
+		"lstm": NewEmptyLSTMControllerWithMemory(3, 2, 4, MemorySpec{N: 5, M: 3, NumHeads: 1, DNC: true}),
+		"gru":  NewEmptyGRUControllerWithMemory(3, 2, 4, MemorySpec{N: 4, M: 2, NumHeads: 2, LRUA: true}),
+		"banks": NewEmptyController1WithMemory(3, 2, 4,
+			MemorySpec{N: 3, M: 2, NumReadHeads: 1, NumWriteHeads: 1}, MemorySpec{N: 9, M: 3, NumHeads: 2, SparseK: 3}),
+	}
+	for name, c := range controllers {
+		weights := c.WeightsVal()
+		for i := range weights {
+			weights[i] = 2*rand.Float64() - 1
+		}
+		times := 11
+		x := makeTensor2(times, 3)
+		y := makeTensor2(times, 2)
+		for i := range x {
+			for j := range x[i] {
+				x[i][j] = rand.Float64()
+			}
+			for j := range y[i] {
+				y[i][j] = rand.Float64()
+			}
+		}
+		model := &LogisticModel{Y: y}
+
+		predictions := Predictions(ForwardBackward(c, x, model))
+		grads := make([]float64, len(weights))
+		copy(grads, c.WeightsGrad())
+		for _, k := range []int{0, 1, 3, 4, times, times + 1} {
+			pdts := ForwardBackwardCheckpointed(c, x, model, k)
+			for i := range pdts {
+				for j := range pdts[i] {
+					if math.Float64bits(pdts[i][j]) != math.Float64bits(predictions[i][j]) {
+						t.Errorf("%s, k = %d: prediction[%d][%d] %v, expected %v", name, k, i, j, pdts[i][j], predictions[i][j])
+					}
+				}
+			}
+			for i, g := range c.WeightsGrad() {
+				if math.Float64bits(g) != math.Float64bits(grads[i]) {
+					t.Errorf("%s, k = %d: %s gradient %v, expected %v", name, k, c.WeightsDesc(i), g, grads[i])
+				}
+			}
+		}
+	}
+}
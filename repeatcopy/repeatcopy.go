@@ -168,8 +168,11 @@ func GenSeq(repeat, seqlen int) ([][]float64, [][]float64) {
 	return input, output
 }
 
+// dataSize is the size of the vectors to be repeated.
+const dataSize = 6
+
 func randData(size int) [][]float64 {
-	vectorSize := 6
+	vectorSize := dataSize
 	data := make([][]float64, size)
 	for i := 0; i < len(data); i++ {
 		data[i] = make([]float64, vectorSize)
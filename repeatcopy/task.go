@@ -0,0 +1,63 @@
+package repeatcopy
+
+import (
+	"fmt"
+	"math/rand"
+
+	"ntm"
+	"ntm/task"
+)
+
+func init() {
+	task.Register("repeatcopy", func(string) (task.Task, error) {
+		return &Task{GenFunc: "bt", MaxRepeat: 10, MaxLen: 10}, nil
+	})
+}
+
+// Task is the repeat copy task as a task.Task, in which NTMs are trained on sequences generated by G[GenFunc] of 1 to
+// MaxLen vectors which are repeated 1 to MaxRepeat times.
+type Task struct {
+	GenFunc   string
+	MaxRepeat int
+	MaxLen    int
+}
+
+func (t *Task) InputSize() int {
+	switch t.GenFunc {
+	case "bt":
+		return dataSize + 4
+	case "lt":
+		return dataSize + 3
+	}
+	return dataSize + 2
+}
+
+func (t *Task) OutputSize() int {
+	return dataSize + 1
+}
+
+func (t *Task) Sample() task.Seq {
+	return t.seq(rand.Intn(t.MaxRepeat)+1, rand.Intn(t.MaxLen)+1)
+}
+
+func (t *Task) seq(repeat, seqlen int) task.Seq {
+	x, y := G[t.GenFunc](repeat, seqlen)
+	return task.Seq{X: x, Y: y, Model: &ntm.LogisticModel{Y: y}}
+}
+
+// Loss returns the loss in nats per bit of the output.
+func (t *Task) Loss(seq task.Seq, predictions [][]float64) float64 {
+	return seq.Model.Loss(predictions) / float64(len(seq.Y)*t.OutputSize())
+}
+
+func (t *Task) Evals() []task.Eval {
+	confs := []struct{ repeat, seqlen int }{{2, 3}, {7, 7}, {15, 10}, {10, 15}}
+	evals := make([]task.Eval, 0, len(confs))
+	for _, conf := range confs {
+		evals = append(evals, task.Eval{
+			Name:   fmt.Sprintf("repeat %d, sequence length %d", conf.repeat, conf.seqlen),
+			Sample: func() task.Seq { return t.seq(conf.repeat, conf.seqlen) },
+		})
+	}
+	return evals
+}
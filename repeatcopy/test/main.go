@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"html/template"
 	"log"
@@ -13,7 +12,7 @@ import (
 )
 
 var (
-	weightsFile = flag.String("weightsFile", "", "trained weights in JSON")
+	weightsFile = flag.String("weightsFile", "", "a checkpoint or trained weights in JSON")
 )
 
 type Run struct {
@@ -39,8 +38,20 @@ func main() {
 	numHeads := 2
 	n := 128
 	m := 20
-	c := ntm.NewEmptyController1(len(x[0]), len(y[0]), h1Size, numHeads, n, m)
-	weightsFromFile(c)
+	spec := ntm.ControllerSpec{Type: ntm.Controller1Type, XSize: len(x[0]), YSize: len(y[0]), HSize: h1Size, Memories: []ntm.MemorySpec{{N: n, M: m, NumHeads: numHeads}}}
+	if *weightsFile == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	ck, err := ntm.LoadCheckpoint(*weightsFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	// Bare arrays of weights dumped before checkpoints existed are of the controller described by spec.
+	c, err := ck.NewControllerWithDefault(spec)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	confs := []RunConf{
 		{Repeat: 2, SeqLen: 3},
@@ -61,7 +72,7 @@ func main() {
 		machines := ntm.ForwardBackward(c, x, model)
 		l := model.Loss(ntm.Predictions(machines))
 		bps := l / float64(len(y)*len(y[0]))
-		log.Printf("conf: %+v, loss: %f", conf, bps)
+		log.Printf("conf: %+v, loss: %f, float32 divergence: %g", conf, bps, ntm.Divergence32(c, &ntm.LogisticModel{}, x, ntm.Predictions(machines)))
 
 		r := Run{
 			Conf:        conf,
@@ -169,25 +180,3 @@ func root(runs []Run) func(http.ResponseWriter, *http.Request) {
 		rootTmpl.Execute(w, page)
 	}
 }
-
-func weightsFromFile(c ntm.Controller) {
-	if *weightsFile == "" {
-		flag.PrintDefaults()
-		os.Exit(1)
-	}
-
-	f, err := os.Open(*weightsFile)
-	if err != nil {
-		log.Fatalf("%v", err)
-	}
-	defer f.Close()
-	ws := make([]float64, 0)
-	if err := json.NewDecoder(f).Decode(&ws); err != nil {
-		log.Fatalf("%v", err)
-	}
-
-	weights := c.WeightsVal()
-	for i, w := range ws {
-		weights[i] = w
-	}
-}
@@ -0,0 +1,53 @@
+package ntm
+
+// A Runner runs a NTM one time step at a time, which is useful for inference on streams of inputs.
+// A Runner runs forward only on an Inference, so that a time step allocates no gradients, and the memory used does
+// not grow with the length of the stream. Unlike an Inference, the output returned by Step is a copy that remains
+// valid, and the states of a Runner can be snapshotted and restored.
+type Runner struct {
+	C     Controller
+	Model DensityModel
+
+	inf *Inference
+}
+
+// NewRunner creates a Runner of the controller c, whose outputs are transformed by model.
+// The ground truth of model is not used.
+func NewRunner(c Controller, model DensityModel) *Runner {
+	return &Runner{C: c, Model: model, inf: NewInference(c, model)}
+}
+
+// Step feeds x to the NTM, and returns its output after being transformed by the DensityModel.
+func (r *Runner) Step(x []float64) []float64 {
+	r.inf.Model = r.Model
+	return append([]float64(nil), r.inf.Step(x)...)
+}
+
+// Reset resets the memory, head weights and reads of the NTM to their bias values, as in MakeEmptyNTM.
+func (r *Runner) Reset() {
+	r.inf.Reset()
+}
+
+// A RunnerState is a snapshot of the states of a Runner,
+// which consist of the memory, the head weights, the reads and the states of the controller.
+type RunnerState struct {
+	states [][]float64
+}
+
+// Snapshot returns the current states of the Runner.
+func (r *Runner) Snapshot() *RunnerState {
+	states := r.inf.states()
+	s := RunnerState{states: make([][]float64, len(states))}
+	for i, v := range states {
+		s.states[i] = append([]float64(nil), v...)
+	}
+	return &s
+}
+
+// Restore restores the states of the Runner to s, which is a snapshot of a Runner of the same controller.
+// The same RunnerState can be restored multiple times.
+func (r *Runner) Restore(s *RunnerState) {
+	for i, v := range r.inf.states() {
+		copy(v, s.states[i])
+	}
+}
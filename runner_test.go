@@ -0,0 +1,60 @@
+package ntm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestRunner(t *testing.T) {
+	for name, c := range inferenceControllers() {
+		weights := c.WeightsVal()
+		for i := range weights {
+			weights[i] = 2*rand.Float64() - 1
+		}
+		x := makeTensor2(12, 3)
+		y := make([]int, len(x))
+		for i := range x {
+			for j := range x[i] {
+				x[i][j] = rand.Float64()
+			}
+			y[i] = rand.Intn(3)
+		}
+		expected := Predictions(ForwardBackward(c, x, &MultinomialModel{Y: y}))
+
+		r := NewRunner(c, &MultinomialModel{})
+		snapAt := 5
+		var snap *RunnerState
+		for i := range x {
+			if i == snapAt {
+				snap = r.Snapshot()
+			}
+			checkRunnerOutput(t, name, i, r.Step(x[i]), expected[i])
+		}
+
+		for k := 0; k < 2; k++ {
+			r.Restore(snap)
+			for i := snapAt; i < len(x); i++ {
+				checkRunnerOutput(t, name, i, r.Step(x[i]), expected[i])
+			}
+		}
+
+		r.Reset()
+		for i := range x {
+			checkRunnerOutput(t, name, i, r.Step(x[i]), expected[i])
+		}
+
+		// The only allocation is the copy of the output.
+		if allocs := testing.AllocsPerRun(10, func() { r.Step(x[0]) }); allocs > 1 {
+			t.Errorf("%s: %f allocations per time step", name, allocs)
+		}
+	}
+}
+
+func checkRunnerOutput(t *testing.T, name string, i int, y, expected []float64) {
+	for j := range y {
+		if math.Abs(y[j]-expected[j]) > 1e-12 {
+			t.Errorf("%s: output[%d][%d] %f, expected %f", name, i, j, y[j], expected[j])
+		}
+	}
+}
@@ -0,0 +1,566 @@
+package ntm
+
+import (
+	"math"
+	"sort"
+
+	"github.com/gonum/blas/blas32"
+	"github.com/gonum/floats"
+)
+
+// sparseMemory is the memory bank in sparse access mode, which is shared by all time steps.
+type sparseMemory struct {
+	N int
+	M int
+	K int // the number of locations accessed by each head
+
+	// Val is the memory after the latest time step of the forward pass.
+	Val []float64
+	// Grad is the gradient on the memory after the time step being backpropagated.
+	Grad []float64
+}
+
+// sparseOp is the memory circuit in sparse access mode in a single time step, in which each head reads and writes
+// only the K memory locations that are most similar to its key, similar to
+// J. W. Rae et al. Scaling Memory-Augmented Neural Networks with Sparse Reads and Writes. arXiv preprint arXiv:1610.09027, 2016.
+//
+// To keep the cost of a time step proportional to K instead of the size of the memory, except for finding the
+// most similar locations, all time steps write to a single sparseMemory in place, keeping copies of only the
+// locations they overwrite. Likewise, the backward pass turns the gradient on the memory at time t into the
+// gradient on the memory at time t-1 in place, by updating only the accessed locations.
+type sparseOp struct {
+	Heads []*Head
+	Mem   *sparseMemory
+
+	WC   []*contentAddressing // the weights of each head over the locations it accesses
+	Rows [][]int              // the positions in rows of the locations accessed by each head
+	R    []*memRead
+
+	rows     []int       // the locations accessed by all heads
+	rowsVal  []float64   // the accessed locations before being written
+	rowsGrad []float64   // the gradients on the accessed locations before being written
+	ws       [][]float64 // the weights of each head over rows
+	erase    [][]float64
+	add      [][]float64
+
+	init []*refocus // the initial weights of an empty sparseOp
+}
+
+// newEmptySparseOp creates the circuit at time -1, in which the memory is mtm1 and the weights are wtm1s.
+func newEmptySparseOp(wtm1s []*refocus, reads []*memRead, mtm1 *writtenMemory, k int) *sparseOp {
+	mem := sparseMemory{
+		N:    mtm1.N,
+		M:    len(mtm1.TopVal) / mtm1.N,
+		K:    k,
+		Val:  make([]float64, len(mtm1.TopVal)),
+		Grad: mtm1.TopGrad,
+	}
+	if mem.K > mem.N {
+		mem.K = mem.N
+	}
+	copy(mem.Val, mtm1.TopVal)
+	op := sparseOp{
+		Mem:  &mem,
+		R:    reads,
+		init: wtm1s,
+	}
+	return &op
+}
+
+func newSparseOp(heads []*Head, mem *sparseMemory) *sparseOp {
+	m := mem.M
+	op := sparseOp{
+		Heads: heads,
+		Mem:   mem,
+		WC:    make([]*contentAddressing, len(heads)),
+		Rows:  make([][]int, len(heads)),
+		R:     make([]*memRead, 0, len(heads)),
+		erase: makeTensor2(len(heads), m),
+		add:   makeTensor2(len(heads), m),
+	}
+
+	pos := make(map[int]int)
+	scores := make([]float64, mem.N)
+	for i, h := range heads {
+		for j := range scores {
+			scores[j] = h.Similarity.value(h.KVal(), mem.Val[j*m:j*m+h.keyLen()])
+		}
+		top := topK(scores, mem.K)
+		op.Rows[i] = make([]int, len(top))
+		for k, j := range top {
+			p, ok := pos[j]
+			if !ok {
+				p = len(op.rows)
+				pos[j] = p
+				op.rows = append(op.rows, j)
+			}
+			op.Rows[i][k] = p
+		}
+	}
+	op.rowsVal = make([]float64, len(op.rows)*m)
+	op.rowsGrad = make([]float64, len(op.rows)*m)
+	for p, j := range op.rows {
+		copy(op.rowsVal[p*m:(p+1)*m], mem.Val[j*m:(j+1)*m])
+	}
+
+	op.ws = makeTensor2(len(heads), len(op.rows))
+	for i, h := range heads {
+		ss := make([]*betaSimilarity, len(op.Rows[i]))
+		for k, p := range op.Rows[i] {
+			s := newSimilarityCircuit(h.Similarity, h.KVal(), h.KGrad(), op.rowsVal[p*m:p*m+h.keyLen()], op.rowsGrad[p*m:p*m+h.keyLen()])
+			ss[k] = newBetaSimilarity(h.BetaVal(), h.BetaGrad(), s)
+		}
+		op.WC[i] = newContentAddressing(ss)
+
+		for k, p := range op.Rows[i] {
+			op.ws[i][p] = op.WC[i].Top[k].Val
+		}
+		if h.reads() {
+			r := &memRead{
+				Offset:  h.KeySize,
+				TopVal:  make([]float64, m-h.KeySize),
+				TopGrad: make([]float64, m-h.KeySize),
+			}
+			for _, p := range op.Rows[i] {
+				floats.AddScaled(r.TopVal, op.ws[i][p], op.rowsVal[p*m+r.Offset:(p+1)*m])
+			}
+			op.R = append(op.R, r)
+		}
+
+		if !h.writes() {
+			continue
+		}
+		addVec := h.AddVal()
+		for j, e := range h.EraseVal() {
+			op.erase[i][j] = Sigmoid(e)
+			op.add[i][j] = Sigmoid(addVec[j])
+		}
+	}
+
+	for p, j := range op.rows {
+		row := mem.Val[j*m : (j+1)*m]
+		for c := range row {
+			v := op.rowsVal[p*m+c]
+			for i, h := range heads {
+				if h.writes() {
+					v *= 1 - op.ws[i][p]*op.erase[i][c]
+				}
+			}
+			for i, h := range heads {
+				if h.writes() {
+					v += op.ws[i][p] * op.add[i][c]
+				}
+			}
+			row[c] = v
+		}
+	}
+	return &op
+}
+
+// topK returns the indices of the k largest scores in descending order of their scores.
+func topK(scores []float64, k int) []int {
+	return topKInto(make([]int, 0, k+1), scores, k)
+}
+
+// topKInto is like topK, except that the indices are stored in top, which is not reallocated if its capacity is
+// larger than k.
+func topKInto(top []int, scores []float64, k int) []int {
+	top = top[:0]
+	for i, s := range scores {
+		if len(top) == k && s <= scores[top[k-1]] {
+			continue
+		}
+		j := sort.Search(len(top), func(a int) bool { return scores[top[a]] < s })
+		top = append(top, 0)
+		copy(top[j+1:], top[j:])
+		top[j] = i
+		if len(top) > k {
+			top = top[:k]
+		}
+	}
+	return top
+}
+
+func (op *sparseOp) reads() []*memRead {
+	return op.R
+}
+
+// weights returns the weights of the heads over the whole memory, which are zero outside the accessed locations.
+func (op *sparseOp) weights() []*refocus {
+	if op.Heads == nil {
+		return op.init
+	}
+	ws := make([]*refocus, len(op.Heads))
+	for i := range ws {
+		ws[i] = &refocus{
+			TopVal:  make([]float64, op.Mem.N),
+			TopGrad: make([]float64, op.Mem.N),
+		}
+		for p, w := range op.ws[i] {
+			ws[i].TopVal[op.rows[p]] = w
+		}
+	}
+	return ws
+}
+
+func (op *sparseOp) next(heads []*Head) memoryOp {
+	return newSparseOp(heads, op.Mem)
+}
+
+// truncate returns a circuit that accesses the same memory, but whose gradients on the memory are kept in a new
+// buffer, so that the gradients of later time steps do not flow into the time steps before the truncation.
+func (op *sparseOp) truncate() memoryOp {
+	mem := *op.Mem
+	mem.Grad = make([]float64, len(mem.Val))
+	t := sparseOp{
+		Mem: &mem,
+		R:   make([]*memRead, len(op.R)),
+	}
+	for i, r := range op.R {
+		t.R[i] = detachRead(r)
+	}
+	return &t
+}
+
+// checkpoint returns a circuit that accesses a copy of the memory, which is needed since the memory is written in
+// place by later time steps. The gradients on the memory are kept in the same buffer as op,
+// which the backward pass turns into the gradients at earlier time steps in place.
+func (op *sparseOp) checkpoint() memoryOp {
+	mem := *op.Mem
+	mem.Val = make([]float64, len(op.Mem.Val))
+	copy(mem.Val, op.Mem.Val)
+	t := sparseOp{
+		Mem: &mem,
+		R:   make([]*memRead, len(op.R)),
+	}
+	for i, r := range op.R {
+		t.R[i] = detachRead(r)
+	}
+	return &t
+}
+
+func (op *sparseOp) setGrads(ck memoryOp) {
+	for i, r := range ck.(*sparseOp).R {
+		copy(op.R[i].TopGrad, r.TopGrad)
+	}
+}
+
+// Backward performs a backward pass.
+// It assumes that the gradients on the reads have been set, and that Mem.Grad holds the gradient on the memory
+// at time t, which it replaces with the gradient on the memory at time t-1.
+func (op *sparseOp) Backward() {
+	m := op.Mem.M
+	grad := op.Mem.Grad
+	wsGrad := makeTensor2(len(op.Heads), len(op.rows))
+	eraseGrad := makeTensor2(len(op.Heads), m)
+	addGrad := makeTensor2(len(op.Heads), m)
+	for p, j := range op.rows {
+		for c := 0; c < m; c++ {
+			g := grad[j*m+c]
+			v := op.rowsVal[p*m+c]
+			var prod float64 = 1
+			for i, h := range op.Heads {
+				if h.writes() {
+					prod *= 1 - op.ws[i][p]*op.erase[i][c]
+				}
+			}
+			op.rowsGrad[p*m+c] += g * prod
+
+			for i, h := range op.Heads {
+				if !h.writes() {
+					continue
+				}
+				var others float64 = 1
+				for q, hq := range op.Heads {
+					if q != i && hq.writes() {
+						others *= 1 - op.ws[q][p]*op.erase[q][c]
+					}
+				}
+				w := op.ws[i][p]
+				wsGrad[i][p] += g * (op.add[i][c] - v*others*op.erase[i][c])
+				eraseGrad[i][c] -= g * v * others * w
+				addGrad[i][c] += g * w
+			}
+		}
+	}
+
+	reads := op.R
+	for i, h := range op.Heads {
+		if h.reads() {
+			r := reads[0]
+			reads = reads[1:]
+			for _, p := range op.Rows[i] {
+				wsGrad[i][p] += floats.Dot(r.TopGrad, op.rowsVal[p*m+r.Offset:(p+1)*m])
+				floats.AddScaled(op.rowsGrad[p*m+r.Offset:(p+1)*m], op.ws[i][p], r.TopGrad)
+			}
+		}
+		for k, p := range op.Rows[i] {
+			op.WC[i].Top[k].Grad += wsGrad[i][p]
+		}
+		backwardMemContentAddressing(op.WC[i])
+
+		if !h.writes() {
+			continue
+		}
+		hErase := h.EraseGrad()
+		hAdd := h.AddGrad()
+		for c := 0; c < m; c++ {
+			e := op.erase[i][c]
+			a := op.add[i][c]
+			hErase[c] += eraseGrad[i][c] * e * (1 - e)
+			hAdd[c] += addGrad[i][c] * a * (1 - a)
+		}
+	}
+
+	for p, j := range op.rows {
+		copy(grad[j*m:(j+1)*m], op.rowsGrad[p*m:(p+1)*m])
+	}
+}
+
+// sparseInference runs a sparseOp forward, as in Inference.
+type sparseInference struct {
+	spec MemorySpec
+	k    int
+	mem  []float64
+
+	scores  []float64
+	wk      []float64   // the weights of a head over the locations it accesses
+	top     [][]int     // the locations accessed by each head
+	ws      [][]float64 // the weights of each head over the whole memory, which are zero outside the accessed locations
+	written []bool      // whether each location has been written in the current time step
+	erase   [][]float64
+	add     [][]float64
+}
+
+func newSparseInference(mem MemorySpec) *sparseInference {
+	numHeads := mem.numWeightings()
+	si := sparseInference{
+		spec:    mem,
+		k:       mem.SparseK,
+		mem:     make([]float64, mem.N*mem.M),
+		scores:  make([]float64, mem.N),
+		top:     make([][]int, numHeads),
+		ws:      makeTensor2(numHeads, mem.N),
+		written: make([]bool, mem.N),
+		erase:   makeTensor2(numHeads, mem.M),
+		add:     makeTensor2(numHeads, mem.M),
+	}
+	if si.k > mem.N {
+		si.k = mem.N
+	}
+	si.wk = make([]float64, si.k)
+	for i := range si.top {
+		si.top[i] = make([]int, 0, si.k+1)
+	}
+	return &si
+}
+
+// reset reads with the initial weights over the whole memory, as in makeEmptyMemoryOp.
+func (si *sparseInference) reset(wtm1, mtm1, reads []float64) {
+	n := si.spec.N
+	rs := si.spec.readSize()
+	copy(si.mem, mtm1)
+	for i := 0; i < si.spec.numReads(); i++ {
+		w := si.ws[i]
+		copy(w, wtm1[i*n:(i+1)*n])
+		softmax(w)
+		readMemory(w, si.mem, si.spec.M, si.spec.KeySize, reads[i*rs:(i+1)*rs])
+		for j := range w {
+			w[j] = 0
+		}
+	}
+}
+
+// states returns the memory only, since the heads of sparse access address memory by content only.
+func (si *sparseInference) states() [][]float64 {
+	return [][]float64{si.mem}
+}
+
+// step runs the same steps as newSparseOp, in which all heads read before the accessed locations are written.
+func (si *sparseInference) step(heads []*Head, reads []float64) {
+	m := si.spec.M
+	rs := si.spec.readSize()
+	for i, h := range heads {
+		for j := range si.scores {
+			si.scores[j] = h.Similarity.value(h.KVal(), si.mem[j*m:j*m+h.keyLen()])
+		}
+		si.top[i] = topKInto(si.top[i], si.scores, si.k)
+		b := math.Exp(*h.BetaVal())
+		wk := si.wk[:len(si.top[i])]
+		for k, j := range si.top[i] {
+			wk[k] = b * circuitSimilarity(h.Similarity, h.KVal(), si.mem[j*m:j*m+h.keyLen()])
+		}
+		softmax(wk)
+		for k, j := range si.top[i] {
+			si.ws[i][j] = wk[k]
+		}
+
+		if h.reads() {
+			r := reads[:rs]
+			for c := range r {
+				r[c] = 0
+			}
+			for _, j := range si.top[i] {
+				floats.AddScaled(r, si.ws[i][j], si.mem[j*m+h.KeySize:(j+1)*m])
+			}
+			reads = reads[rs:]
+		}
+		if h.writes() {
+			addVec := h.AddVal()
+			for c, e := range h.EraseVal() {
+				si.erase[i][c] = Sigmoid(e)
+				si.add[i][c] = Sigmoid(addVec[c])
+			}
+		}
+	}
+
+	for _, top := range si.top[:len(heads)] {
+		for _, j := range top {
+			if si.written[j] {
+				continue
+			}
+			si.written[j] = true
+			row := si.mem[j*m : (j+1)*m]
+			for c, v := range row {
+				for i, h := range heads {
+					if h.writes() {
+						v *= 1 - si.ws[i][j]*si.erase[i][c]
+					}
+				}
+				for i, h := range heads {
+					if h.writes() {
+						v += si.ws[i][j] * si.add[i][c]
+					}
+				}
+				row[c] = v
+			}
+		}
+	}
+	for i, top := range si.top[:len(heads)] {
+		for _, j := range top {
+			si.ws[i][j] = 0
+			si.written[j] = false
+		}
+	}
+}
+
+// sparseInference32 is the float32 counterpart of sparseInference.
+type sparseInference32 struct {
+	spec MemorySpec
+	k    int
+	mem  []float32
+
+	scores  []float64 // the scores are float64 so that the locations are found with topKInto
+	wk      []float32
+	top     [][]int
+	ws      [][]float32
+	written []bool
+	erase   [][]float32
+	add     [][]float32
+}
+
+func newSparseInference32(mem MemorySpec) *sparseInference32 {
+	numHeads := mem.numWeightings()
+	si := sparseInference32{
+		spec:    mem,
+		k:       mem.SparseK,
+		mem:     make([]float32, mem.N*mem.M),
+		scores:  make([]float64, mem.N),
+		top:     make([][]int, numHeads),
+		ws:      makeTensor2Float32(numHeads, mem.N),
+		written: make([]bool, mem.N),
+		erase:   makeTensor2Float32(numHeads, mem.M),
+		add:     makeTensor2Float32(numHeads, mem.M),
+	}
+	if si.k > mem.N {
+		si.k = mem.N
+	}
+	si.wk = make([]float32, si.k)
+	for i := range si.top {
+		si.top[i] = make([]int, 0, si.k+1)
+	}
+	return &si
+}
+
+func (si *sparseInference32) reset(wtm1, mtm1, reads []float32) {
+	n := si.spec.N
+	rs := si.spec.readSize()
+	copy(si.mem, mtm1)
+	for i := 0; i < si.spec.numReads(); i++ {
+		w := si.ws[i]
+		copy(w, wtm1[i*n:(i+1)*n])
+		softmax32(w)
+		readMemory32(w, si.mem, si.spec.M, si.spec.KeySize, reads[i*rs:(i+1)*rs])
+		for j := range w {
+			w[j] = 0
+		}
+	}
+}
+
+func (si *sparseInference32) step(heads []*head32, reads []float32) {
+	m := si.spec.M
+	rs := si.spec.readSize()
+	for i, h := range heads {
+		for j := range si.scores {
+			si.scores[j] = float64(similarity32(h.Similarity, h.k(), si.mem[j*m:j*m+h.keyLen()]))
+		}
+		si.top[i] = topKInto(si.top[i], si.scores, si.k)
+		b := float32(math.Exp(float64(h.beta())))
+		wk := si.wk[:len(si.top[i])]
+		for k, j := range si.top[i] {
+			wk[k] = b * float32(si.scores[j])
+		}
+		softmax32(wk)
+		for k, j := range si.top[i] {
+			si.ws[i][j] = wk[k]
+		}
+
+		if h.reads() {
+			r := reads[:rs]
+			for c := range r {
+				r[c] = 0
+			}
+			for _, j := range si.top[i] {
+				row := si.mem[j*m+h.KeySize : (j+1)*m]
+				blas32.Axpy(len(r), si.ws[i][j], blas32.Vector{Inc: 1, Data: row}, blas32.Vector{Inc: 1, Data: r})
+			}
+			reads = reads[rs:]
+		}
+		if h.writes() {
+			addVec := h.add()
+			for c, e := range h.erase() {
+				si.erase[i][c] = sigmoid32(e)
+				si.add[i][c] = sigmoid32(addVec[c])
+			}
+		}
+	}
+
+	for _, top := range si.top[:len(heads)] {
+		for _, j := range top {
+			if si.written[j] {
+				continue
+			}
+			si.written[j] = true
+			row := si.mem[j*m : (j+1)*m]
+			for c, v := range row {
+				for i, h := range heads {
+					if h.writes() {
+						v *= 1 - si.ws[i][j]*si.erase[i][c]
+					}
+				}
+				for i, h := range heads {
+					if h.writes() {
+						v += si.ws[i][j] * si.add[i][c]
+					}
+				}
+				row[c] = v
+			}
+		}
+	}
+	for i, top := range si.top[:len(heads)] {
+		for _, j := range top {
+			si.ws[i][j] = 0
+			si.written[j] = false
+		}
+	}
+}
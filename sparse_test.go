@@ -0,0 +1,77 @@
+package ntm
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSparse(t *testing.T) {
+	testSparse(t, MemorySpec{N: 8, M: 3, NumHeads: 2, SparseK: 3})
+}
+
+func TestSparseReadWriteHeads(t *testing.T) {
+	testSparse(t, MemorySpec{N: 8, M: 3, NumReadHeads: 2, NumWriteHeads: 1, SparseK: 3})
+}
+
+func testSparse(t *testing.T, mem MemorySpec) {
+	times := 9
+	x := makeTensor2(times, 4)
+	for i := 0; i < len(x); i++ {
+		for j := 0; j < len(x[i]); j++ {
+			x[i][j] = rand.Float64()
+		}
+	}
+	y := makeTensor2(times, 4)
+	for i := 0; i < len(y); i++ {
+		for j := 0; j < len(y[i]); j++ {
+			y[i][j] = rand.Float64()
+		}
+	}
+	h1Size := 3
+	c := NewEmptyController1WithMemory(len(x[0]), len(y[0]), h1Size, mem)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	model := &LogisticModel{Y: y}
+	ForwardBackward(c, x, model)
+	checkForwardBackwardGradients(t, c, x, model)
+}
+
+// TestSparseLargeMemory checks that sparse access scales to large memories, by running ForwardBackward on a memory
+// whose dense circuits would take a prohibitive amount of time and space.
+func TestSparseLargeMemory(t *testing.T) {
+	times := 20
+	x := makeTensor2(times, 4)
+	for i := range x {
+		for j := range x[i] {
+			x[i][j] = rand.Float64()
+		}
+	}
+	mem := MemorySpec{N: 50000, M: 8, NumHeads: 2, SparseK: 4}
+	c := NewEmptyController1WithMemory(len(x[0]), len(x[0]), 10, mem)
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+
+	machines := ForwardBackward(c, x, &LogisticModel{Y: x})
+	for t1, m := range machines {
+		op := m.memOp.(*sparseOp)
+		if len(op.rows) > mem.NumHeads*mem.SparseK {
+			t.Errorf("%d locations accessed at time %d, expected at most %d", len(op.rows), t1, mem.NumHeads*mem.SparseK)
+		}
+	}
+}
+
+func TestTopK(t *testing.T) {
+	scores := []float64{0.3, 0.9, -1, 0.5, 0.9, 0.1}
+	if top := topK(scores, 3); !reflect.DeepEqual(top, []int{1, 4, 3}) {
+		t.Errorf("got %v, expected %v", top, []int{1, 4, 3})
+	}
+	if top := topK(scores, len(scores)); !reflect.DeepEqual(top, []int{1, 4, 3, 0, 5, 2}) {
+		t.Errorf("got %v, expected %v", top, []int{1, 4, 3, 0, 5, 2})
+	}
+}
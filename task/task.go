@@ -0,0 +1,83 @@
+/*
+Package task defines a common interface of the tasks on which NTMs are trained, along with a registry of tasks by name,
+so that the programs in the train and test subfolders can train and test NTMs on any registered task.
+
+A task registers itself in the init function of its package, which is imported for its side effects:
+
+	import _ "ntm/copytask"
+*/
+package task
+
+import (
+	"fmt"
+	"sort"
+
+	"ntm"
+)
+
+// A Seq is a sequence sampled from a Task.
+type Seq struct {
+	X [][]float64 // the inputs at each time step
+	// Y are the expected outputs at each time step, which are one-hot vectors for tasks with a MultinomialModel.
+	Y [][]float64
+	// Model is the DensityModel of the expected outputs, which is used to train and evaluate a NTM on X.
+	Model ntm.DensityModel
+}
+
+// A Task generates the sequences on which NTMs are trained and evaluated.
+type Task interface {
+	// InputSize returns the size of the input vectors.
+	InputSize() int
+	// OutputSize returns the size of the output vectors.
+	OutputSize() int
+	// Sample samples a training sequence.
+	Sample() Seq
+	// Loss returns the loss of predictions on seq, normalized in the way the task reports it,
+	// such as nats per bit of the expected outputs.
+	Loss(seq Seq, predictions [][]float64) float64
+	// Evals returns the configurations on which trained NTMs are evaluated.
+	Evals() []Eval
+}
+
+// An Eval is a configuration on which trained NTMs are evaluated, such as sequences longer than those in training.
+type Eval struct {
+	Name   string
+	Sample func() Seq
+}
+
+// A Reporter is a Task that reports metrics besides the loss, such as the per-bit error.
+type Reporter interface {
+	Report(seq Seq, predictions [][]float64) string
+}
+
+// A Factory creates a Task. data is the path to the dataset of tasks that need one, and is ignored by other tasks.
+type Factory func(data string) (Task, error)
+
+var registry = make(map[string]Factory)
+
+// Register makes a Task available by name. It panics if a Task is already registered by the same name.
+func Register(name string, f Factory) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("task %s registered twice", name))
+	}
+	registry[name] = f
+}
+
+// New creates the Task registered by name.
+func New(name, data string) (Task, error) {
+	f, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown task %q, registered tasks are %v", name, Names())
+	}
+	return f(data)
+}
+
+// Names returns the sorted names of the registered tasks.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"ntm"
+	_ "ntm/associativerecall"
+	_ "ntm/copytask"
+	_ "ntm/ngram"
+	_ "ntm/poem"
+	_ "ntm/prioritysort"
+	_ "ntm/repeatcopy"
+	"ntm/task"
+	"ntm/tester"
+)
+
+var (
+	weightsFile = flag.String("weightsFile", "", "a checkpoint written by a training program")
+	taskName    = flag.String("task", "", "the task to test on, which defaults to the task of the checkpoint")
+	data        = flag.String("data", "", "the dataset of tasks that need one, such as poem")
+)
+
+func main() {
+	flag.Parse()
+	if *weightsFile == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	ck, err := ntm.LoadCheckpoint(*weightsFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	// Bare arrays of weights do not describe their controller, which only the test program of their task knows.
+	if ck.Controller.Type == "" {
+		log.Fatalf("%s holds no controller, test it with the test program of its task", *weightsFile)
+	}
+	c, err := ck.NewController()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *taskName == "" {
+		*taskName = ck.Task
+	}
+	t, err := task.New(*taskName, *data)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if err := tester.Serve(":9000", tester.Evaluate(t, c)); err != nil {
+		log.Printf("%v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+
+	"ntm"
+	_ "ntm/associativerecall"
+	_ "ntm/copytask"
+	_ "ntm/ngram"
+	_ "ntm/poem"
+	_ "ntm/prioritysort"
+	_ "ntm/repeatcopy"
+	"ntm/task"
+	"ntm/trainer"
+)
+
+var (
+	taskName = flag.String("task", "", fmt.Sprintf("the task to train on, which is one of %v", task.Names()))
+	data     = flag.String("data", "", "the dataset of tasks that need one, such as poem")
+	seed     = flag.Int64("seed", 2, "the seed provided to rand.Seed")
+
+	cntlType = flag.String("controller", ntm.Controller1Type, "the type of the controller, which is one of controller1, gru and lstm")
+	hSize    = flag.Int("hSize", 100, "the size of the hidden layer of the controller")
+	numHeads = flag.Int("numHeads", 1, "the number of memory heads")
+	n        = flag.Int("n", 128, "the number of vectors in the memory")
+	m        = flag.Int("m", 20, "the size of a vector in the memory")
+	optName  = flag.String("optimizer", "rmsprop", fmt.Sprintf("the optimizer, which is one of %v", optimizerNames()))
+	window   = flag.Int("window", 0, "the number of time steps in each window of truncated backpropagation through time, or 0 for full backpropagation")
+
+	port        = flag.Int("port", 8080, "the port of the web server that tracks the training progress")
+	logInterval = flag.Int("logInterval", 1000, "the number of iterations between logging the loss")
+)
+
+// adamParams are the typical hyperparameters of Adam, which are shared by AdamW.
+var adamParams = ntm.AdamParams{LearningRate: 1e-3, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}
+
+// optimizers are the optimizers selectable by the -optimizer flag, each with its typical hyperparameters.
+var optimizers = map[string]func(c ntm.Controller) ntm.Optimizer{
+	"sgdmomentum": func(c ntm.Controller) ntm.Optimizer { return ntm.NewSGDMomentum(c) },
+	"rmsprop":     func(c ntm.Controller) ntm.Optimizer { return ntm.NewRMSProp(c) },
+	"adam":        func(c ntm.Controller) ntm.Optimizer { return ntm.NewAdam(c, adamParams) },
+	"adamw": func(c ntm.Controller) ntm.Optimizer {
+		return ntm.NewAdamW(c, ntm.AdamWParams{AdamParams: adamParams, WeightDecay: 1e-2})
+	},
+	"adagrad": func(c ntm.Controller) ntm.Optimizer {
+		return ntm.NewAdagrad(c, ntm.AdagradParams{LearningRate: 1e-2, Epsilon: 1e-8})
+	},
+	"adadelta": func(c ntm.Controller) ntm.Optimizer {
+		return ntm.NewAdadelta(c, ntm.AdadeltaParams{Rho: 0.95, Epsilon: 1e-6})
+	},
+}
+
+func optimizerNames() []string {
+	names := make([]string, 0, len(optimizers))
+	for name := range optimizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func main() {
+	flag.Parse()
+
+	conf := trainer.Config{
+		Task:     *taskName,
+		TaskData: *data,
+		Seed:     *seed,
+		Window:   *window,
+		Port:     *port,
+
+		LogInterval: *logInterval,
+	}
+	// A resumed run trains the task and controller of its checkpoint with its optimizer, ignoring the flags that
+	// describe them, so that the random draws are replayed as in the run that wrote the checkpoint.
+	if ck := trainer.Checkpoint(); ck != nil {
+		if ck.Task == "" {
+			log.Fatalf("the checkpoint records no task, resume it with the training program of its task")
+		}
+		conf.Task = ck.Task
+		conf.TaskData = ck.TaskData
+		conf.Spec = ck.Controller
+	}
+	t, err := task.New(conf.Task, conf.TaskData)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if trainer.Checkpoint() == nil {
+		newOpt, ok := optimizers[*optName]
+		if !ok {
+			log.Fatalf("unknown optimizer %q, optimizers are %v", *optName, optimizerNames())
+		}
+		conf.Optimizer = newOpt
+		conf.Spec = ntm.ControllerSpec{
+			Type:     *cntlType,
+			XSize:    t.InputSize(),
+			YSize:    t.OutputSize(),
+			HSize:    *hSize,
+			Memories: []ntm.MemorySpec{{N: *n, M: *m, NumHeads: *numHeads}},
+		}
+	}
+
+	trainer.Run(t, conf)
+}
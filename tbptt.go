@@ -0,0 +1,70 @@
+package ntm
+
+import (
+	"fmt"
+)
+
+// ForwardBackwardTruncated is like ForwardBackward, except that it performs truncated backpropagation through time,
+// in which the sequence is split into windows of the given number of time steps.
+// The memory, addressing weights, reads and states of the controller are carried forward across windows,
+// but gradients are backpropagated only within each window.
+// Since only the machines of the current window are kept alive, the memory needed is proportional to the window
+// instead of the whole sequence, which is why the predictions at each time step are returned instead of the machines.
+// If window is not positive, it is the same as ForwardBackward, otherwise c must be one of the controllers of
+// this package, which implement truncation.
+func ForwardBackwardTruncated(c Controller, in [][]float64, out DensityModel, window int) [][]float64 {
+	if window <= 0 {
+		return Predictions(ForwardBackward(c, in, out))
+	}
+	weights := c.WeightsGrad()
+	for i := range weights {
+		weights[i] = 0
+	}
+
+	empty, reads, wtm1s, cas := makeEmptyNTM(c)
+	predictions := make([][]float64, len(in))
+	prev := empty
+	for start := 0; start < len(in); start += window {
+		machines := make([]*NTM, 0, window)
+		for t := start; t < len(in) && t < start+window; t++ {
+			prev = NewNTM(prev, in[t])
+			machines = append(machines, prev)
+			predictions[t] = prev.Controller.YVal()
+		}
+		for i := len(machines) - 1; i >= 0; i-- {
+			m := machines[i]
+			out.Model(start+i, m.Controller.YVal(), m.Controller.YGrad())
+			m.backward()
+		}
+		if start == 0 {
+			backwardEmptyNTM(c, reads, wtm1s, cas)
+		}
+		prev = prev.truncate()
+	}
+	return predictions
+}
+
+// TrainTruncated computes the gradients of a sequence with ForwardBackwardTruncated, and updates the weights of c
+// with opt, which must be an Optimizer of c. It returns the predictions at each time step.
+func TrainTruncated(opt Optimizer, c Controller, in [][]float64, out DensityModel, window int) [][]float64 {
+	predictions := ForwardBackwardTruncated(c, in, out, window)
+	opt.Update()
+	return predictions
+}
+
+// A truncater is a Controller that can be cut from the Controllers at previous time steps, as required by truncated
+// backpropagation through time and ForwardBackwardCheckpointed.
+type truncater interface {
+	// truncate returns a Controller with the same states, which is cut from the Controllers at previous time steps
+	// so that gradients do not flow past it, and that the previous Controllers can be garbage collected.
+	truncate() Controller
+}
+
+// truncateController returns the truncation of c, and panics if c cannot be truncated.
+func truncateController(c Controller) Controller {
+	t, ok := c.(truncater)
+	if !ok {
+		panic(fmt.Sprintf("controller %T cannot be truncated", c))
+	}
+	return t.truncate()
+}
@@ -0,0 +1,144 @@
+package ntm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestForwardBackwardTruncated(t *testing.T) {
+	controllers := map[string]Controller{
+		"controller1": NewEmptyController1(3, 2, 4, 2, 5, 3),
+		"lstm":        NewEmptyLSTMControllerWithMemory(3, 2, 4, MemorySpec{N: 5, M: 3, NumHeads: 1, DNC: true}),
+		"gru":         NewEmptyGRUControllerWithMemory(3, 2, 4, MemorySpec{N: 4, M: 2, NumHeads: 2, LRUA: true}),
+		"banks": NewEmptyController1WithMemory(3, 2, 4,
+			MemorySpec{N: 3, M: 2, NumReadHeads: 1, NumWriteHeads: 1}, MemorySpec{N: 4, M: 3, NumHeads: 1, DNC: true}),
+	}
+	for name, c := range controllers {
+		weights := c.WeightsVal()
+		for i := range weights {
+			weights[i] = 2*rand.Float64() - 1
+		}
+		times := 10
+		x := makeTensor2(times, 3)
+		y := makeTensor2(times, 2)
+		for i := range x {
+			for j := range x[i] {
+				x[i][j] = rand.Float64()
+			}
+			for j := range y[i] {
+				y[i][j] = rand.Float64()
+			}
+		}
+		model := &LogisticModel{Y: y}
+
+		// A window that covers the whole sequence is the same as ForwardBackward.
+		machines := ForwardBackward(c, x, model)
+		expected := make([]float64, len(weights))
+		copy(expected, c.WeightsGrad())
+		predictions := ForwardBackwardTruncated(c, x, model, times)
+		if l, el := model.Loss(predictions), model.Loss(Predictions(machines)); math.Abs(l-el) > 1e-12 {
+			t.Errorf("%s: loss %f, expected %f", name, l, el)
+		}
+		for i, g := range c.WeightsGrad() {
+			if math.Abs(g-expected[i]) > 1e-12 {
+				t.Errorf("%s: wrong %s gradient %f, expected %f", name, c.WeightsDesc(i), g, expected[i])
+			}
+		}
+
+		window := 3
+		predictions = ForwardBackwardTruncated(c, x, model, window)
+		if l, el := model.Loss(predictions), model.Loss(Predictions(machines)); math.Abs(l-el) > 1e-12 {
+			t.Errorf("%s: truncation changed the loss to %f from %f", name, l, el)
+		}
+		checkTruncatedGradients(t, name, c, x, y, window)
+	}
+}
+
+// checkTruncatedGradients checks the gradients computed by ForwardBackwardTruncated against the finite differences
+// of the loss, in which the states carried across windows are held constant.
+func checkTruncatedGradients(t *testing.T, name string, c Controller, x, y [][]float64, window int) {
+	wGrads := make([]float64, len(c.WeightsGrad()))
+	copy(wGrads, c.WeightsGrad())
+
+	// The states at the start of each window, which are computed with the unperturbed weights.
+	starts := []*NTM{}
+	m := MakeEmptyNTM(c)
+	for t := range x {
+		if t%window == 0 {
+			starts = append(starts, m)
+		}
+		m = NewNTM(m, x[t])
+		if (t+1)%window == 0 {
+			m = m.truncate()
+		}
+	}
+	model := &LogisticModel{Y: y}
+	lossOf := func() float64 {
+		var l float64 = 0
+		for w, start := range starts {
+			m := start
+			if w == 0 {
+				m = MakeEmptyNTM(c)
+			}
+			end := (w + 1) * window
+			if end > len(x) {
+				end = len(x)
+			}
+			machines := make([]*NTM, 0, window)
+			for t := w * window; t < end; t++ {
+				m = NewNTM(m, x[t])
+				model.Model(t, m.Controller.YVal(), m.Controller.YGrad())
+				machines = append(machines, m)
+			}
+			l += (&LogisticModel{Y: y[w*window : end]}).Loss(Predictions(machines))
+		}
+		return l
+	}
+	lx := lossOf()
+
+	for i, v := range c.WeightsVal() {
+		h := machineEpsilonSqrt * math.Max(math.Abs(v), 1)
+		vph := v + h
+		c.WeightsVal()[i] = vph
+		lvph := lossOf()
+		c.WeightsVal()[i] = v
+		grad := (lvph - lx) / (vph - v)
+
+		if math.IsNaN(grad) || math.Abs(grad-wGrads[i]) > 1e-5 {
+			t.Errorf("%s: wrong %s gradient expected %f, got %f", name, c.WeightsDesc(i), grad, wGrads[i])
+		}
+	}
+}
+
+// TestForwardBackwardTruncatedSparse checks that truncation carries the sparse memory, which is written in place,
+// across windows.
+func TestForwardBackwardTruncatedSparse(t *testing.T) {
+	c := NewEmptyController1WithMemory(3, 3, 4, MemorySpec{N: 9, M: 3, NumHeads: 2, SparseK: 3})
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 2*rand.Float64() - 1
+	}
+	x := makeTensor2(10, 3)
+	for i := range x {
+		for j := range x[i] {
+			x[i][j] = rand.Float64()
+		}
+	}
+	model := &LogisticModel{Y: x}
+
+	expected := model.Loss(Predictions(ForwardBackward(c, x, model)))
+	mtm1Grad := make([]float64, len(c.Mtm1BiasGrad()))
+	copy(mtm1Grad, c.Mtm1BiasGrad())
+	if l := model.Loss(ForwardBackwardTruncated(c, x, model, len(x))); math.Abs(l-expected) > 1e-12 {
+		t.Errorf("loss %f, expected %f", l, expected)
+	}
+	for i, g := range c.Mtm1BiasGrad() {
+		if math.Abs(g-mtm1Grad[i]) > 1e-12 {
+			t.Errorf("wrong mtm1 gradient %f, expected %f", g, mtm1Grad[i])
+		}
+	}
+	if l := model.Loss(ForwardBackwardTruncated(c, x, model, 4)); math.Abs(l-expected) > 1e-12 {
+		t.Errorf("truncation changed the loss to %f from %f", l, expected)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Package tester evaluates trained NTMs on the tasks of package ntm/task, for the test programs of the tasks.
+The evaluations are served on a web page, which draws the inputs, outputs, predictions and addressing weights of each
+evaluation with d3.
+*/
+package tester
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"ntm"
+	"ntm/task"
+)
+
+// A Run is the evaluation of a NTM on a sequence sampled from an Eval of a task.
+type Run struct {
+	Name        string
+	Loss        float64
+	Report      string
+	X           [][]float64
+	Y           [][]float64
+	Predictions [][]float64
+	HeadWeights [][][]float64
+}
+
+// Evaluate runs the controller c on a sequence sampled from each Eval of t, and logs the losses.
+func Evaluate(t task.Task, c ntm.Controller) []Run {
+	evals := t.Evals()
+	runs := make([]Run, 0, len(evals))
+	for _, e := range evals {
+		seq := e.Sample()
+		machines := ntm.ForwardBackward(c, seq.X, seq.Model)
+		predictions := ntm.Predictions(machines)
+		r := Run{
+			Name:        e.Name,
+			Loss:        t.Loss(seq, predictions),
+			X:           seq.X,
+			Y:           seq.Y,
+			Predictions: predictions,
+			HeadWeights: ntm.HeadWeights(machines),
+		}
+		report := ""
+		if rp, ok := t.(task.Reporter); ok {
+			r.Report = rp.Report(seq, predictions)
+			report = ", " + r.Report
+		}
+		log.Printf("%s, loss: %f%s", r.Name, r.Loss, report)
+		runs = append(runs, r)
+	}
+	return runs
+}
+
+// Serve serves the web page of runs on the TCP network address addr, as in http.ListenAndServe.
+func Serve(addr string, runs []Run) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		page := struct {
+			Runs []Run
+		}{
+			Runs: runs,
+		}
+		rootTmpl.Execute(w, page)
+	})
+	return http.ListenAndServe(addr, mux)
+}
+
+var rootTmpl = template.Must(template.New("").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+  <script type="text/javascript" src="http://d3js.org/d3.v3.js"></script>
+</head>
+<body>
+<script type="text/javascript">
+var page = {{.}};
+
+var colorbrewer = {};
+colorbrewer.RdYlBu = {};
+colorbrewer.RdYlBu[9] = ["#d73027","#f46d43","#fdae61","#fee090","#ffffbf","#e0f3f8","#abd9e9","#74add1","#4575b4"];
+
+// palette draws a color palette explaining that 0.0 maps to blue and 1.0 maps to red.
+function palette(parent) {
+  var matrix = colorbrewer.RdYlBu[9].map(function(d, i) {
+    return [{"text": ""}, {"bgcolor": d}];
+  });
+  matrix[0][0].text = "1.0";
+  matrix[(colorbrewer.RdYlBu[9].length-1) / 2][0].text = "0.5";
+  matrix[colorbrewer.RdYlBu[9].length-1][0].text = "0.0";
+  var table = parent.append("table")
+  var tr = table.selectAll("tr").data(matrix).
+    enter().append("tr");
+  var td = tr.selectAll("td").data(function(d) { return d; }).
+    enter().append("td").
+    text(function(d) { return d.text; }).
+    style("background-color", function(d) { return d.bgcolor; }).
+    style("min-width", "1em").
+    style("height", "1em");
+  return table;
+}
+
+// imshow displays a 2 dimensional matrix.
+function imshow(parent, matrix) {
+  var table = parent.append("table");
+  var tr = table.selectAll("tr").data(matrix).
+    enter().append("tr");
+  var colormap = d3.scale.quantize().domain([0, 1]).range(colorbrewer.RdYlBu[9].slice().reverse());
+  var td = tr.selectAll("td").data(function(d) { return d; }).
+    enter().append("td").
+    style("background-color", colormap).
+    style("min-width", "1em").
+    style("height", "1em");
+  return table;
+}
+
+var allRuns = d3.select("body").append("div").attr("id", "runs");
+var run = allRuns.selectAll("div").
+  data(page.Runs).
+  enter().append("div").
+  attr("id", function(d, i){ return "run-"+i;});
+
+run.append("h4").text(function(d){ return d.Name+", loss: "+d.Loss.toPrecision(3)+(d.Report ? ", "+d.Report : ""); });
+
+// Draw x along with a palette.
+var x = run.append("table").style("border-spacing", "0px").append("tr");
+imshow(x.append("td").style("padding-left", "0px"), function(d){ return d3.transpose(d.X); });
+palette(x.append("td"));
+
+// Draw predictions
+imshow(run, function(d){ return d3.transpose(d.Y); });
+imshow(run, function(d){ return d3.transpose(d.Predictions); });
+
+var headWs = run.append("div");
+headWs.selectAll("div").
+  data(function(d){ return d.HeadWeights; }).
+  enter().call(imshow, function(d){ return d3.transpose(d); });
+</script>
+<body>
+</html>
+`))
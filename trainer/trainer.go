@@ -0,0 +1,276 @@
+/*
+Package trainer trains NTMs on the tasks of package ntm/task, for the training programs of the tasks.
+
+Besides training, Run serves the progress of the training on a web server, resumes training from checkpoints, and
+writes checkpoints periodically and before exiting on SIGINT or SIGTERM. These are configured by the flags below,
+which are parsed by the flag.Parse of the training programs:
+
+	-resume      resume training from the checkpoint in this file
+	-checkpoint  the file to which checkpoints are written
+	-autosave    the interval between periodic checkpoints
+	-cpuprofile  write cpu profile to file
+*/
+package trainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"runtime/pprof"
+	"syscall"
+	"time"
+
+	"ntm"
+	"ntm/task"
+)
+
+var (
+	cpuprofile     = flag.String("cpuprofile", "", "write cpu profile to file")
+	resume         = flag.String("resume", "", "resume training from the checkpoint in this file")
+	checkpointFile = flag.String("checkpoint", "checkpoint", "the file to which checkpoints are written periodically, and on SIGINT or SIGTERM before exiting")
+	autosave       = flag.Duration("autosave", 10*time.Minute, "the interval between periodic checkpoints, or 0 to write a checkpoint only before exiting")
+)
+
+// A Config configures a training run.
+type Config struct {
+	Task     string // the name of the task, which is recorded in checkpoints
+	TaskData string // the dataset of the task, which is recorded in checkpoints
+	// Spec describes the trained controller, whose weights are initialized uniformly in [-0.5, 0.5].
+	Spec ntm.ControllerSpec
+	Seed int64 // the seed provided to rand.Seed
+	// Optimizer creates the Optimizer that trains the controller c, which defaults to ntm.NewRMSProp.
+	Optimizer func(c ntm.Controller) ntm.Optimizer
+
+	// Window is the number of time steps in each window of truncated backpropagation through time,
+	// or 0 for full backpropagation.
+	Window int
+	Port   int // the port of the web server
+	// LogInterval is the number of iterations between logging the mean loss of the iterations since the previous log,
+	// which defaults to 1000.
+	LogInterval int
+}
+
+var resumed *ntm.Checkpoint
+
+// Checkpoint returns the checkpoint given by the -resume flag, or nil if the flag is not set.
+// Programs call it to configure Run from the checkpoint, which is loaded only once.
+func Checkpoint() *ntm.Checkpoint {
+	if *resume == "" || resumed != nil {
+		return resumed
+	}
+	ck, err := ntm.LoadCheckpoint(*resume)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	resumed = ck
+	return resumed
+}
+
+// Run trains a controller described by conf.Spec on t with the Optimizer of conf, until the program receives SIGINT
+// or SIGTERM.
+//
+// If the -resume flag is set, training is resumed from the checkpoint instead, whose seed and optimizer are used in
+// place of those of conf. The checkpoint must be of the same task and controller as conf, since otherwise the random
+// draws are not replayed as in the run that wrote the checkpoint.
+func Run(t task.Task, conf Config) {
+	if *cpuprofile != "" {
+		f, err := os.Create(*cpuprofile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pprof.StartCPUProfile(f)
+		defer pprof.StopCPUProfile()
+	}
+	if conf.LogInterval == 0 {
+		conf.LogInterval = 1000
+	}
+
+	ck := Checkpoint()
+	if ck != nil {
+		if ck.Task != conf.Task {
+			log.Fatalf("%s is a checkpoint of task %q, not %q", *resume, ck.Task, conf.Task)
+		}
+		conf.Seed = ck.Seed
+	}
+
+	s := newServer(conf.Port)
+	rand.Seed(conf.Seed)
+	log.Printf("task: %s, seed: %d", conf.Task, conf.Seed)
+
+	c, err := conf.Spec.NewEmpty()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if ck != nil {
+		// Compare with the spec of the controller, in which its constructor has filled in the defaults.
+		trained, err := ntm.NewCheckpoint(c, nil, 0, conf.Seed)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if !reflect.DeepEqual(ck.Controller, trained.Controller) {
+			log.Fatalf("the controller %+v of %s is not the trained controller %+v", ck.Controller, *resume, trained.Controller)
+		}
+	}
+	weights := c.WeightsVal()
+	for i := range weights {
+		weights[i] = 1 * (rand.Float64() - 0.5)
+	}
+
+	losses := make([]float64, 0)
+	doPrint := false
+
+	if conf.Optimizer == nil {
+		conf.Optimizer = func(c ntm.Controller) ntm.Optimizer { return ntm.NewRMSProp(c) }
+	}
+	opt := conf.Optimizer(c)
+	start := 1
+	if ck != nil {
+		c, opt, err = ck.Resume()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		losses = ck.Losses
+		for i := 1; i <= ck.Iteration; i++ {
+			t.Sample()
+		}
+		start = ck.Iteration + 1
+		log.Printf("resumed from iteration %d", ck.Iteration)
+	}
+	log.Printf("numweights: %d", len(c.WeightsVal()))
+
+	newCheckpoint := func(iteration int) *ntm.Checkpoint {
+		ck, err := ntm.NewCheckpoint(c, opt, iteration, conf.Seed)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		ck.Losses = losses
+		ck.Task = conf.Task
+		ck.TaskData = conf.TaskData
+		return ck
+	}
+
+	// Write a final checkpoint on SIGINT or SIGTERM, so that no training is lost when the run is stopped.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	lastSave := time.Now()
+	var lossSum float64 = 0
+	numLosses := 0
+	for i := start; ; i++ {
+		seq := t.Sample()
+		predictions := ntm.TrainTruncated(opt, c, seq.X, seq.Model, conf.Window)
+		lossSum += t.Loss(seq, predictions)
+		numLosses++
+		if i%conf.LogInterval == 0 {
+			l := lossSum / float64(numLosses)
+			lossSum, numLosses = 0, 0
+			losses = append(losses, l)
+			report := ""
+			if r, ok := t.(task.Reporter); ok {
+				report = ", " + r.Report(seq, predictions)
+			}
+			if co, ok := opt.(*ntm.ClippedOptimizer); ok {
+				report += fmt.Sprintf(", grad norm: %f", co.Norm)
+			}
+			log.Printf("%d, loss: %f, seq length: %d%s", i, l, len(seq.X), report)
+		}
+
+		s.handle(c, func() *ntm.Checkpoint { return newCheckpoint(i) }, losses, &doPrint)
+
+		if i%conf.LogInterval == 0 && doPrint {
+			log.Printf("y: %+v", seq.Y)
+			log.Printf("pred: %s", ntm.Sprint2(predictions))
+		}
+
+		select {
+		case sig := <-sigs:
+			log.Printf("received %v", sig)
+			saveCheckpoint(newCheckpoint(i))
+			return
+		default:
+		}
+		if *autosave > 0 && time.Since(lastSave) >= *autosave {
+			saveCheckpoint(newCheckpoint(i))
+			lastSave = time.Now()
+		}
+	}
+}
+
+func saveCheckpoint(ck *ntm.Checkpoint) {
+	if err := ck.Save(*checkpointFile); err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Printf("saved the checkpoint of iteration %d to %s", ck.Iteration, *checkpointFile)
+}
+
+// A server serves the progress of the training. Its requests are handled by the training loop between iterations,
+// so that they observe the weights of whole iterations only.
+type server struct {
+	weightsChan    chan chan []byte
+	checkpointChan chan chan []byte
+	lossChan       chan chan []float64
+	printDebugChan chan struct{}
+}
+
+func newServer(port int) *server {
+	s := &server{
+		weightsChan:    make(chan chan []byte),
+		checkpointChan: make(chan chan []byte),
+		lossChan:       make(chan chan []float64),
+		printDebugChan: make(chan struct{}),
+	}
+	http.HandleFunc("/Weights", func(w http.ResponseWriter, r *http.Request) {
+		c := make(chan []byte)
+		s.weightsChan <- c
+		w.Write(<-c)
+	})
+	http.HandleFunc("/Checkpoint", func(w http.ResponseWriter, r *http.Request) {
+		c := make(chan []byte)
+		s.checkpointChan <- c
+		w.Write(<-c)
+	})
+	http.HandleFunc("/Loss", func(w http.ResponseWriter, r *http.Request) {
+		c := make(chan []float64)
+		s.lossChan <- c
+		json.NewEncoder(w).Encode(<-c)
+	})
+	http.HandleFunc("/PrintDebug", func(w http.ResponseWriter, r *http.Request) {
+		s.printDebugChan <- struct{}{}
+	})
+	go func() {
+		log.Printf("Listening on port %d", port)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}()
+	return s
+}
+
+func (s *server) handle(c ntm.Controller, newCheckpoint func() *ntm.Checkpoint, losses []float64, doPrint *bool) {
+	select {
+	case cn := <-s.weightsChan:
+		b, err := json.Marshal(c.WeightsVal())
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		cn <- b
+	case cn := <-s.checkpointChan:
+		var b bytes.Buffer
+		if err := newCheckpoint().Write(&b); err != nil {
+			log.Fatalf("%v", err)
+		}
+		cn <- b.Bytes()
+	case cn := <-s.lossChan:
+		cn <- losses
+	case <-s.printDebugChan:
+		*doPrint = !*doPrint
+	default:
+		return
+	}
+}